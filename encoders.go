@@ -1,10 +1,20 @@
 package streamer
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github.com/xfrr/goffmpeg/transcoder"
+	"io"
+	"log/slog"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Encoder is an interface for encoding video. Any type that wants to satisfy
@@ -13,156 +23,496 @@ type Encoder interface {
 	EncodeToMP4(v *Video, baseFileName string) error
 	EncodeToHLS(v *Video, baseFileName string) error
 	EncodeToHLSEncrypted(v *Video, baseFileName string) error
+	EncodeToDASH(v *Video, baseFileName string) error
+	EncodeToCMAF(v *Video, baseFileName string) error
+	EncodeToPreview(v *Video, baseFileName string) error
+	EncodeThumbnails(v *Video, baseFileName string) error
+	EncodeSprites(v *Video, baseFileName string) error
 }
 
 // VideoEncoder is a type which satisfies the Encoder interface because it implements
 // all the methods specified in Encoder.
-type VideoEncoder struct{}
+type VideoEncoder struct {
+	Logger *slog.Logger // If not nil, where each run of ffmpeg is logged, with keys redacted.
+}
 
 // EncodeToMP4 takes a Video object and a base file name, and encodes to MP4 format.
+// The ffmpeg process is killed if the context of v is cancelled, and progress is sent to v.ProgressChan.
 func (ve *VideoEncoder) EncodeToMP4(v *Video, baseFileName string) error {
-	// Create a transcoder.
-	trans := new(transcoder.Transcoder)
-
-	// Build output path.
-	outputPath := fmt.Sprintf("%s/%s.mp4", v.OutputDir, baseFileName)
+	if err := validateSubtitles(v.Options.Subtitles); err != nil {
+		return err
+	}
 
-	// Initialize the transcoder.
-	err := trans.Initialize(v.InputFile, outputPath)
+	// Run ffmpeg, and wait for the transcoding process to end.
+	err := ve.runFFmpeg(v, mp4Args(v, baseFileName)...)
 	if err != nil {
 		return err
 	}
 
-	// Set codec.
-	trans.MediaFile().SetVideoCodec("libx264")
+	return nil
+}
 
-	// Start transcoder process.
-	done := trans.Run(false)
+// mp4Args returns the arguments for ffmpeg to encode v to MP4 format, writing baseFileName.mp4.
+// Any subtitles are added as tracks, except that the first is burned into the video instead if
+// v.Options.BurnSubtitles is set.
+func mp4Args(v *Video, baseFileName string) []string {
+	args := []string{"-y", "-i", v.InputFile}
 
-	// Wait for the transcoding process to end.
-	err = <-done
-	if err != nil {
-		return err
+	tracks := v.Options.Subtitles
+	var burn *Subtitle
+	if v.Options.BurnSubtitles && len(tracks) > 0 {
+		burn, tracks = &tracks[0], tracks[1:]
+	}
+	for _, s := range tracks {
+		args = append(args, "-i", s.File)
 	}
 
-	return nil
+	if burn != nil {
+		args = append(args, "-vf", "subtitles="+filterValue(burn.File))
+	}
+	if len(tracks) > 0 {
+		args = append(args, "-map", "0:v:0", "-map", "0:a:0?") // The audio is optional.
+		for i := range tracks {
+			args = append(args, "-map", fmt.Sprintf("%d:s:0", i+1))
+		}
+		args = append(args, "-c:s", "mov_text")
+		for i, s := range tracks {
+			if s.Language != "" {
+				args = append(args, fmt.Sprintf("-metadata:s:s:%d", i), "language="+s.Language)
+			}
+			args = append(args, fmt.Sprintf("-metadata:s:s:%d", i), "title="+s.label(i+1))
+		}
+	}
+
+	return append(args,
+		"-c:v", "libx264", // Our video codec (H.264/MPEG-4 AVC video coding format).
+		"-progress", "-",
+		"-nostats",
+		fmt.Sprintf("%s/%s.mp4", v.OutputDir, baseFileName),
+	)
 }
 
 // EncodeToHLS takes a Video object and a base file name, and encodes to HLS format.
+// The ffmpeg process is killed if the context of v is cancelled, and progress is sent to v.ProgressChan.
 func (ve *VideoEncoder) EncodeToHLS(v *Video, baseFileName string) error {
-	// result is a channel that we will send the results of the encode attempt to.
-	result := make(chan error)
-
-	go func(result chan error) {
-		ffmpegCmd := exec.Command(
-			"ffmpeg",
-			"-i", v.InputFile,
-			"-map", "0:v:0", // We need three of this line and the next (one
-			"-map", "0:a:0", // for each of the resolutions we want to encode to).
-			"-map", "0:v:0",
-			"-map", "0:a:0",
-			"-map", "0:v:0",
-			"-map", "0:a:0",
-			"-c:v", "libx264", // Our video codec (H.264/MPEG-4 AVC video coding format).
-			"-crf", "22",
-			"-c:a", "aac",
-			"-ar", "48000",
-			"-filter:v:0", "scale=-2:1080", // 1080p resolution.
-			"-maxrate:v:0", v.Options.MaxRate1080p,
-			"-b:a:0", "128k",
-			"-filter:v:1", "scale=-2:720", // 720p resolution.
-			"-maxrate:v:1", v.Options.MaxRate720p,
-			"-b:a:1", "128k",
-			"-filter:v:2", "scale=-2:480", // 480p resolution.
-			"-maxrate:v:2", v.Options.MaxRate480p,
-			"-b:a:2", "64k",
-			"-var_stream_map", "v:0,a:0,name:1080p v:1,a:1,name:720p v:2,a:2,name:480p", // Our map of resolutions.
-			"-preset", "slow",
-			"-hls_list_size", "0",
-			"-threads", "0",
-			"-f", "hls",
-			"-hls_playlist_type", "event",
-			"-hls_time", strconv.Itoa(v.Options.SegmentDuration),
-			"-hls_flags", "independent_segments",
-			"-hls_segment_type", "mpegts",
-			"-hls_playlist_type", "vod",
-			"-master_pl_name", fmt.Sprintf("%s.m3u8", baseFileName),
-			"-profile:v", "baseline", // The baseline profile is compatible with most devices
-			"-level", "3.0",
-			"-progress", "-",
-			"-nostats",
-			fmt.Sprintf("%s/%s-%%v.m3u8", v.OutputDir, baseFileName),
-		)
-
-		_, err := ffmpegCmd.CombinedOutput()
-
-		// Send err to result channel. It will be nil if everything worked.
-		result <- err
-	}(result)
-
-	// Wait for the goroutine to send results to the result chan.
-	err := <-result
+	plan, err := ve.plan(v)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = ve.runFFmpeg(v, hlsArgs(v, baseFileName, plan)...)
+	if err != nil {
+		return err
+	}
+
+	return ve.addHLSSubtitles(v, baseFileName, plan.duration, true)
 }
 
 // EncodeToHLSEncrypted takes a Video object and a base file name, and encodes to encrypted HLS format.
+// The ffmpeg process is killed if the context of v is cancelled, and progress is sent to v.ProgressChan.
 func (ve *VideoEncoder) EncodeToHLSEncrypted(v *Video, baseFileName string) error {
-	result := make(chan error)
-
-	go func(result chan error) {
-		ffmpegCmd := exec.Command(
-			"ffmpeg",
-			"-i", v.InputFile,
-			"-map", "0:v:0", // We need three of this line and the next (one
-			"-map", "0:a:0", // for each of the resolutions we want to encode to).
-			"-map", "0:v:0",
-			"-map", "0:a:0",
-			"-map", "0:v:0",
-			"-map", "0:a:0",
-			"-c:v", "libx264", // Our video codec (H.264/MPEG-4 AVC video coding format).
-			"-crf", "22",
-			"-c:a", "aac",
-			"-ar", "48000",
-			"-filter:v:0", "scale=-2:1080", // 1080p resolution.
-			"-maxrate:v:0", v.Options.MaxRate1080p,
-			"-b:a:0", "128k",
-			"-filter:v:1", "scale=-2:720", // 720p resolution.
-			"-maxrate:v:1", v.Options.MaxRate720p,
-			"-b:a:1", "128k",
-			"-filter:v:2", "scale=-2:480", // 480p resolution.
-			"-maxrate:v:2", v.Options.MaxRate480p,
-			"-b:a:2", "64k",
-			"-var_stream_map", "v:0,a:0,name:1080p v:1,a:1,name:720p v:2,a:2,name:480p", // Our map of resolutions.
-			"-preset", "slow",
-			"-hls_list_size", "0",
-			"-threads", "0",
-			"-f", "hls",
-			"-hls_playlist_type", "event",
-			"-hls_time", strconv.Itoa(v.Options.SegmentDuration),
-			"-hls_flags", "independent_segments",
-			"-hls_segment_type", "mpegts",
-			"-hls_key_info_file", v.Options.KeyInfo,
-			"-hls_playlist_type", "vod",
-			"-master_pl_name", fmt.Sprintf("%s.m3u8", baseFileName),
-			"-profile:v", "baseline", // The baseline profile is compatible with most devices.
-			"-level", "3.0",
-			"-progress", "-",
-			"-nostats",
-			fmt.Sprintf("%s/%s-%%v.m3u8", v.OutputDir, baseFileName),
-		)
-
-		_, err := ffmpegCmd.CombinedOutput()
-		result <- err
-	}(result)
-
-	err := <-result
+	plan, err := ve.plan(v)
+	if err != nil {
+		return err
+	}
+
+	err = ve.runFFmpeg(v, hlsArgs(v, baseFileName, plan, "-hls_key_info_file", v.Options.KeyInfo)...)
+	if err != nil {
+		return err
+	}
+
+	return ve.addHLSSubtitles(v, baseFileName, plan.duration, true)
+}
+
+// audioSource says where the audio for an adaptive encode comes from.
+type audioSource int
+
+const (
+	audioFromInput audioSource = iota // The first audio stream of the input.
+	audioSilent                       // A silent track generated by ffmpeg, for input with no audio.
+	audioNone                         // No audio at all, for input with no audio.
+)
+
+// encodePlan holds what we need to know, beyond the video itself, to build the ffmpeg
+// arguments for an adaptive (HLS, DASH, or CMAF) encode.
+type encodePlan struct {
+	renditions []Rendition   // The renditions to encode to.
+	audio      audioSource   // Where the audio comes from.
+	duration   time.Duration // The duration of the input.
+}
+
+// plan probes the input of v and works out how to encode it. Unless v.Options.AllowUpscale is
+// set, renditions taller than the source are dropped. If the input has no audio, either a silent
+// track is added or audio is left out, depending on v.Options.SilentAudio. The names of the
+// renditions are recorded in v, so that they can be reported back to the client.
+func (ve *VideoEncoder) plan(v *Video) (encodePlan, error) {
+	if err := validateSubtitles(v.Options.Subtitles); err != nil {
+		return encodePlan{}, err
+	}
+
+	renditions, err := v.renditions()
+	if err != nil {
+		return encodePlan{}, err
+	}
+
+	info, err := Probe(v.Context(), v.InputFile)
+	if err != nil {
+		return encodePlan{}, err
+	}
+
+	if stream := info.VideoStream(); stream != nil && !v.Options.AllowUpscale {
+		renditions = fitRenditions(renditions, stream.DisplayHeight())
+	}
+
+	audio := audioFromInput
+	if info.AudioStream() == nil {
+		audio = audioNone
+		if v.Options.SilentAudio {
+			audio = audioSilent
+		}
+	}
+
+	v.renditionNames = make([]string, len(renditions))
+	for i, r := range renditions {
+		v.renditionNames[i] = r.Name
+	}
+
+	return encodePlan{renditions: renditions, audio: audio, duration: info.Duration}, nil
+}
+
+// inputArgs returns the ffmpeg arguments for the inputs of an encode: the input file of v, and
+// a generated silent track if the plan calls for one.
+func (p encodePlan) inputArgs(v *Video) []string {
+	args := []string{"-i", v.InputFile}
+	if p.audio == audioSilent {
+		args = append(args, "-f", "lavfi", "-i", "anullsrc=channel_layout=stereo:sample_rate=48000")
+	}
+	return args
+}
+
+// audioMap returns the stream specifier of the audio to map, or an empty string if there is none.
+func (p encodePlan) audioMap() string {
+	switch p.audio {
+	case audioFromInput:
+		return "0:a:0"
+	case audioSilent:
+		return "1:a:0"
+	default:
+		return ""
+	}
+}
+
+// audioArgs returns the ffmpeg arguments which set the codec of the audio. The silent track
+// goes on forever, so it also tells ffmpeg to stop when the video does.
+func (p encodePlan) audioArgs() []string {
+	switch p.audio {
+	case audioNone:
+		return nil
+	case audioSilent:
+		return []string{"-c:a", "aac", "-ar", "48000", "-shortest"}
+	default:
+		return []string{"-c:a", "aac", "-ar", "48000"}
+	}
+}
+
+// hlsArgs returns the arguments for ffmpeg to encode v to HLS format, with one variant stream
+// for each of the renditions in the plan, writing the master playlist as baseFileName.m3u8. Any
+// extra arguments for the hls muxer are added just before the output file.
+func hlsArgs(v *Video, baseFileName string, plan encodePlan, extra ...string) []string {
+	args := plan.inputArgs(v)
+	audio := plan.audioMap()
+
+	// We need a video and an audio stream for each of the renditions we want to encode to.
+	for range plan.renditions {
+		args = append(args, "-map", "0:v:0")
+		if audio != "" {
+			args = append(args, "-map", audio)
+		}
+	}
+
+	args = append(args,
+		"-c:v", "libx264", // Our video codec (H.264/MPEG-4 AVC video coding format).
+		"-crf", "22",
+	)
+	args = append(args, plan.audioArgs()...)
+
+	streamMap := make([]string, len(plan.renditions))
+	for i, r := range plan.renditions {
+		args = append(args, r.videoArgs(i)...)
+		if audio != "" {
+			args = append(args, fmt.Sprintf("-b:a:%d", i), r.AudioBitrate)
+			streamMap[i] = fmt.Sprintf("v:%d,a:%d,name:%s", i, i, r.Name)
+		} else {
+			streamMap[i] = fmt.Sprintf("v:%d,name:%s", i, r.Name)
+		}
+	}
+
+	args = append(args,
+		"-var_stream_map", strings.Join(streamMap, " "), // Our map of resolutions.
+		"-preset", "slow",
+		"-hls_list_size", "0",
+		"-threads", "0",
+		"-f", "hls",
+		"-hls_playlist_type", "event",
+		"-hls_time", strconv.Itoa(v.Options.SegmentDuration),
+		"-hls_flags", "independent_segments",
+		"-hls_segment_type", "mpegts",
+		"-hls_playlist_type", "vod",
+		"-master_pl_name", fmt.Sprintf("%s.m3u8", baseFileName),
+		"-progress", "-",
+		"-nostats",
+	)
+	args = append(args, extra...)
+
+	return append(args, fmt.Sprintf("%s/%s-%%v.m3u8", v.OutputDir, baseFileName))
+}
+
+// EncodeToDASH takes a Video object and a base file name, and encodes to MPEG-DASH format.
+// The ffmpeg process is killed if the context of v is cancelled, and progress is sent to v.ProgressChan.
+func (ve *VideoEncoder) EncodeToDASH(v *Video, baseFileName string) error {
+	plan, err := ve.plan(v)
 	if err != nil {
 		return err
 	}
 
+	err = ve.runFFmpeg(v, dashArgs(v, v.OutputDir, baseFileName, plan)...)
+	if err != nil {
+		return err
+	}
+
+	return ve.addDASHSubtitles(v, baseFileName, true)
+}
+
+// EncodeToCMAF takes a Video object and a base file name, and encodes to fragmented MP4 (CMAF)
+// segments, with an init segment for each rendition. Both a DASH manifest and an HLS master
+// playlist are written, and they reference the same segment files. ffmpeg names the HLS playlists
+// of the renditions media_0.m3u8 and so on, whatever the base file name, so the encode is written
+// to a directory of its own, and then moved into the output directory with the playlists renamed.
+// The ffmpeg process is killed if the context of v is cancelled, and progress is sent to v.ProgressChan.
+func (ve *VideoEncoder) EncodeToCMAF(v *Video, baseFileName string) error {
+	plan, err := ve.plan(v)
+	if err != nil {
+		return err
+	}
+
+	workDir := filepath.Join(v.OutputDir, baseFileName+"-cmaf.tmp")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return classify(v.Context(), err, nil)
+	}
+	defer os.RemoveAll(workDir)
+
+	err = ve.runFFmpeg(v, dashArgs(
+		v,
+		workDir,
+		baseFileName,
+		plan,
+		"-dash_segment_type", "mp4",
+		"-hls_playlist", "1", // Write HLS playlists alongside the DASH manifest.
+		"-hls_master_name", fmt.Sprintf("%s.m3u8", baseFileName),
+	)...)
+	if err != nil {
+		return err
+	}
+	if err := moveCMAF(workDir, v.OutputDir, baseFileName); err != nil {
+		return classify(v.Context(), err, nil)
+	}
+
+	// The segments are fragmented MP4, which start at zero, so the WebVTT files need no
+	// timestamp map, and can be shared by both manifests.
+	if err := ve.addHLSSubtitles(v, baseFileName, plan.duration, false); err != nil {
+		return err
+	}
+	return ve.addDASHSubtitles(v, baseFileName, false)
+}
+
+// cmafPlaylist matches the names which ffmpeg gives the HLS playlists of the renditions of a
+// CMAF encode, where they appear in the master playlist.
+var cmafPlaylist = regexp.MustCompile(`(?m)(^|")media_(\d+)\.m3u8`)
+
+// cmafPlaylistName returns the name we give the HLS playlist of the nth rendition of a CMAF encode.
+func cmafPlaylistName(baseFileName, n string) string {
+	return fmt.Sprintf("%s-media-%s.m3u8", baseFileName, n)
+}
+
+// moveCMAF moves the output of a CMAF encode from workDir into dir. The HLS playlists of the
+// renditions are given names which start with the base file name, and the master playlist is
+// changed to match.
+func moveCMAF(workDir, dir, baseFileName string) error {
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		from := filepath.Join(workDir, name)
+
+		if name == baseFileName+".m3u8" {
+			master, err := os.ReadFile(from)
+			if err != nil {
+				return err
+			}
+			master = cmafPlaylist.ReplaceAllFunc(master, func(m []byte) []byte {
+				sub := cmafPlaylist.FindSubmatch(m)
+				return []byte(string(sub[1]) + cmafPlaylistName(baseFileName, string(sub[2])))
+			})
+			if err := os.WriteFile(from, master, 0644); err != nil {
+				return err
+			}
+		}
+		if sub := cmafPlaylist.FindStringSubmatch(name); sub != nil && sub[0] == name {
+			name = cmafPlaylistName(baseFileName, sub[2])
+		}
+
+		if err := os.Rename(from, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dashArgs returns the arguments for ffmpeg to encode v to MPEG-DASH format, with one
+// representation for each of the renditions in the plan, writing the manifest as baseFileName.mpd
+// in dir. Any extra arguments for the dash muxer are added just before the output file.
+func dashArgs(v *Video, dir, baseFileName string, plan encodePlan, extra ...string) []string {
+	// ffmpeg needs a segment duration for DASH, so fall back to its own default if we don't have one.
+	segmentDuration := v.Options.SegmentDuration
+	if segmentDuration <= 0 {
+		segmentDuration = 5
+	}
+
+	args := append([]string{"-y"}, plan.inputArgs(v)...)
+
+	// We need a video stream for each of the renditions we want to encode to, but the
+	// audio is shared by all of them, so we only map it once, at the bitrate of the first.
+	for range plan.renditions {
+		args = append(args, "-map", "0:v:0")
+	}
+	adaptationSets := "id=0,streams=v" // One adaptation set for video and, if there is audio, one for audio.
+	if audio := plan.audioMap(); audio != "" {
+		args = append(args, "-map", audio)
+		args = append(args, plan.audioArgs()...)
+		args = append(args, "-b:a", plan.renditions[0].AudioBitrate)
+		adaptationSets += " id=1,streams=a"
+	}
+
+	args = append(args,
+		"-c:v", "libx264", // Our video codec (H.264/MPEG-4 AVC video coding format).
+		"-crf", "22",
+	)
+
+	for i, r := range plan.renditions {
+		args = append(args, r.videoArgs(i)...)
+	}
+
+	args = append(args,
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentDuration), // Keyframes on segment boundaries.
+		"-preset", "slow",
+		"-threads", "0",
+		"-f", "dash",
+		"-seg_duration", strconv.Itoa(segmentDuration),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-adaptation_sets", adaptationSets,
+		"-init_seg_name", fmt.Sprintf("%s-init-$RepresentationID$.m4s", baseFileName),
+		"-media_seg_name", fmt.Sprintf("%s-chunk-$RepresentationID$-$Number%%05d$.m4s", baseFileName),
+		"-progress", "-",
+		"-nostats",
+	)
+	args = append(args, extra...)
+
+	return append(args, fmt.Sprintf("%s/%s.mpd", dir, baseFileName))
+}
+
+// runFFmpeg runs ffmpeg with the given arguments and waits for it to finish. The process
+// is killed if the context of v is done. If the arguments include "-progress -", the progress
+// which ffmpeg writes to stdout is sent to v.ProgressChan. If ffmpeg fails, the error is an
+// *EncodeError holding the command line and the end of the log. If v.Options.SaveLog is set,
+// the whole log is also appended to a file named after the output in the output directory.
+// If the encode is being traced, the run is recorded as a span with the exit code of ffmpeg.
+func (ve *VideoEncoder) runFFmpeg(v *Video, args ...string) (err error) {
+	log := ve.logger().With(slog.Int(logVideoID, v.ID), slog.String(logEncodingType, v.EncodingType))
+	log.Debug("running ffmpeg", slog.Any("args", redactArgs(args)))
+	started := time.Now()
+
+	span := v.startSpan(spanFFmpeg)
+	defer func() {
+		var encodeErr *EncodeError
+		switch {
+		case err == nil:
+			span.SetAttributes(attrExitCode.Int(0))
+			log.Debug("ffmpeg finished", slog.Duration(logDuration, time.Since(started)))
+		case errors.As(err, &encodeErr):
+			span.SetAttributes(attrExitCode.Int(encodeErr.ExitCode))
+			log.Warn("ffmpeg failed",
+				slog.Duration(logDuration, time.Since(started)),
+				slog.Int("exit_code", encodeErr.ExitCode),
+				slog.Any("errors", encodeErr.Errors),
+				slog.Any(logError, err),
+			)
+		default:
+			log.Warn("ffmpeg failed", slog.Duration(logDuration, time.Since(started)), slog.Any(logError, err))
+		}
+		endSpan(span, err)
+	}()
+
+	// ffmpeg is killed if it goes too long without reporting progress, e.g. because the input
+	// is corrupt in a way that makes it hang. Runs which don't report progress, such as those
+	// which take images, are only limited by the timeout of the job.
+	ctx, cancel := context.WithCancelCause(v.Context())
+	defer cancel(nil)
+	p := newProgressParser(v)
+	if stall := v.stallTimeout; stall > 0 && slices.Contains(args, "-progress") {
+		watchdog := time.AfterFunc(stall, func() {
+			cancel(fmt.Errorf("%w: no progress from ffmpeg for %s", ErrTimeout, stall))
+		})
+		defer watchdog.Stop()
+		p.seen = func() { watchdog.Reset(stall) }
+	}
+
+	ffmpegCmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	stdout, err := ffmpegCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := ffmpegCmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	var logReader io.Reader = stderr
+	if v.Options.SaveLog {
+		logFile, err := os.OpenFile(v.logFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer logFile.Close()
+		fmt.Fprintf(logFile, "%s\n", strings.Join(redactArgs(ffmpegCmd.Args), " "))
+		logReader = io.TeeReader(stderr, logFile)
+	}
+
+	if err := ffmpegCmd.Start(); err != nil {
+		return newEncodeError(ffmpegCmd.Args, classify(ctx, err, nil), nil)
+	}
+
+	// Both pipes have to be read to the end before we can wait for ffmpeg.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.readLog(logReader)
+	}()
+	go func() {
+		defer wg.Done()
+		p.readProgress(stdout)
+	}()
+	wg.Wait()
+
+	if err := ffmpegCmd.Wait(); err != nil {
+		return newEncodeError(ffmpegCmd.Args, classify(ctx, err, p.log), p.log)
+	}
+
 	return nil
 }
@@ -3,6 +3,7 @@
 package streamer
 
 import (
+	"context"
 	"os"
 	"testing"
 )
@@ -25,6 +26,9 @@ func Test_All_Encoders(t *testing.T) {
 		{name: "hls-encrypted error", expectSuccess: false, args: args{id: 3, file: "a.mp4", enc: "hls-encrypted", output: "./testdata/output", ops: nil}},
 		{name: "mp4", expectSuccess: true, args: args{id: 4, file: "./testdata/dog.mp4", enc: "mp4", output: "./testdata/output", ops: nil}},
 		{name: "hls", expectSuccess: true, args: args{id: 5, file: "./testdata/dog.mp4", enc: "hls", output: "./testdata/output", ops: nil}},
+		{name: "dash error", expectSuccess: false, args: args{id: 6, file: "a.mp4", enc: "dash", output: "./testdata/output", ops: nil}},
+		{name: "dash", expectSuccess: true, args: args{id: 7, file: "./testdata/dog.mp4", enc: "dash", output: "./testdata/output", ops: nil}},
+		{name: "cmaf", expectSuccess: true, args: args{id: 8, file: "./testdata/dog.mp4", enc: "cmaf", output: "./testdata/output", ops: nil}},
 		{name: "hls invalid output", expectSuccess: false, args: args{id: 5, file: "./testdata/dog.mp4", enc: "hls", output: "/foo", ops: nil}},
 	}
 
@@ -49,3 +53,25 @@ func Test_All_Encoders(t *testing.T) {
 		}
 	})
 }
+
+func Test_Probe(t *testing.T) {
+	info, err := Probe(context.Background(), "./testdata/dog.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.VideoStream() == nil {
+		t.Error("expected dog.mp4 to have a video stream")
+	}
+	if info.Duration <= 0 {
+		t.Errorf("expected a positive duration but got %s", info.Duration)
+	}
+
+	if _, err := Probe(context.Background(), "./testdata/nope.mp4"); err == nil {
+		t.Error("expected an error probing a missing file")
+	}
+
+	v := Video{InputFile: "./testdata/dog.mp4", Options: &VideoOptions{}}
+	if err := v.Validate(context.Background()); err != nil {
+		t.Errorf("expected dog.mp4 to be valid but got %s", err)
+	}
+}
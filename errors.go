@@ -0,0 +1,159 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+var (
+	// ErrBinaryNotFound means that ffmpeg or ffprobe could not be found in the path.
+	ErrBinaryNotFound = errors.New("ffmpeg or ffprobe not found")
+
+	// ErrInvalidInput means that the input file, or the options for encoding it, are not usable.
+	// Validation errors such as ErrNoVideoStream also match ErrInvalidInput.
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrDiskFull means that there was no space left to write the output.
+	ErrDiskFull = errors.New("disk full")
+
+	// ErrKilled means that ffmpeg was killed by a signal which we didn't send, e.g. by the OOM killer.
+	ErrKilled = errors.New("killed by signal")
+
+	// ErrTimeout means that the encode took too long, and was killed.
+	ErrTimeout = errors.New("timed out")
+)
+
+// EncodeError is returned by VideoEncoder when ffmpeg fails, and holds what you need to work
+// out why. It wraps the classified error, so errors.Is works with the sentinel errors above.
+type EncodeError struct {
+	Command  []string `json:"command"`   // The command line: ffmpeg, followed by its arguments, with sensitive ones redacted.
+	ExitCode int      `json:"exit_code"` // The exit code of ffmpeg, or -1 if it didn't start or was killed by a signal.
+	Log      []string `json:"log"`       // The last lines of the log output of ffmpeg.
+	Errors   []string `json:"errors"`    // The lines of Log which describe errors.
+	Err      error    `json:"-"`         // The underlying error.
+}
+
+// newEncodeError returns an *EncodeError for the command which failed with err, and
+// wrote log as the end of its log output. Sensitive arguments, such as key files, are
+// redacted from the command, since it may be sent on to clients.
+func newEncodeError(command []string, err error, log []string) *EncodeError {
+	e := &EncodeError{
+		Command:  redactArgs(command),
+		ExitCode: -1,
+		Log:      log,
+		Errors:   errorLines(log),
+		Err:      err,
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.ExitCode = exitErr.ExitCode()
+	}
+
+	return e
+}
+
+// Error returns a summary of the failure, ending with the last error ffmpeg logged.
+func (e *EncodeError) Error() string {
+	msg := e.Err.Error()
+	if len(e.Command) > 0 {
+		msg = fmt.Sprintf("%s: %s", e.Command[0], msg)
+	}
+	if len(e.Errors) > 0 {
+		msg = fmt.Sprintf("%s: %s", msg, e.Errors[len(e.Errors)-1])
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// errorLineRegex matches the lines of ffmpeg log output which describe errors.
+var errorLineRegex = regexp.MustCompile(`(?i)error|invalid|failed|unable|could not|cannot|no such|not found|no space|permission denied|unrecognized|does not contain`)
+
+// errorLines returns the lines of log which describe errors.
+func errorLines(log []string) []string {
+	var lines []string
+	for _, line := range log {
+		if line = strings.TrimSpace(line); line != "" && errorLineRegex.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// invalidInputMessages are the things ffmpeg and ffprobe say when they can't use the input.
+var invalidInputMessages = []string{
+	"Invalid data found when processing input",
+	"No such file or directory",
+	"does not contain any stream",
+	"Output file #0 does not contain any stream",
+	"Stream map '",
+	"Unrecognized option",
+	"Error opening input",
+	"moov atom not found",
+}
+
+// classify wraps an error from running ffmpeg or ffprobe in the sentinel error which describes
+// it, using the log output of the command where the error itself doesn't say enough. Errors
+// caused by ctx being cancelled, other than by running out of time, and errors which we can't
+// classify, are returned unchanged.
+func classify(ctx context.Context, err error, log []string) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, ErrTimeout):
+			return fmt.Errorf("%w: %w", cause, err)
+		case errors.Is(cause, context.DeadlineExceeded):
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+		return err
+	}
+
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrBinaryNotFound, err)
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%w: %w", ErrDiskFull, err)
+	}
+
+	for _, line := range log {
+		if strings.Contains(line, "No space left on device") {
+			return fmt.Errorf("%w: %w", ErrDiskFull, err)
+		}
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return fmt.Errorf("%w: %w", ErrKilled, err)
+		}
+	}
+
+	for _, line := range log {
+		for _, msg := range invalidInputMessages {
+			if strings.Contains(line, msg) {
+				return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+			}
+		}
+	}
+
+	return err
+}
+
+// IsTransient returns true if err is worth retrying: ffmpeg was killed, timed out, or ran out of
+// disk space. Errors which will happen again however many times we try, such as invalid input or
+// a missing ffmpeg, are not transient, and neither are errors which we can't classify.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrKilled) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrDiskFull)
+}
@@ -0,0 +1,120 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_classify(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 1").Run()
+	killedErr := exec.Command("sh", "-c", "kill -KILL $$").Run()
+	notFoundErr := exec.Command("no-such-ffmpeg").Run()
+
+	timedOut, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-timedOut.Done()
+
+	cancelled, cancelCause := context.WithCancelCause(context.Background())
+	cancelCause(ErrCancelled)
+
+	stalled, stall := context.WithCancelCause(context.Background())
+	stall(fmt.Errorf("%w: no progress", ErrTimeout))
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		err       error
+		log       []string
+		want      error
+		transient bool
+	}{
+		{name: "nil", ctx: context.Background(), err: nil, want: nil},
+		{name: "not found", ctx: context.Background(), err: notFoundErr, want: ErrBinaryNotFound},
+		{name: "killed", ctx: context.Background(), err: killedErr, want: ErrKilled, transient: true},
+		{name: "timed out", ctx: timedOut, err: killedErr, want: ErrTimeout, transient: true},
+		{name: "stalled", ctx: stalled, err: killedErr, want: ErrTimeout, transient: true},
+		{name: "disk full from log", ctx: context.Background(), err: exitErr, log: []string{"av_interleaved_write_frame(): No space left on device"}, want: ErrDiskFull, transient: true},
+		{name: "disk full from errno", ctx: context.Background(), err: fmt.Errorf("mkdir: %w", syscall.ENOSPC), want: ErrDiskFull, transient: true},
+		{name: "invalid input", ctx: context.Background(), err: exitErr, log: []string{"a.mp4: Invalid data found when processing input"}, want: ErrInvalidInput},
+		{name: "unknown", ctx: context.Background(), err: exitErr, log: []string{"something odd"}, want: exitErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classify(tt.ctx, tt.err, tt.log)
+			if !errors.Is(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("expected %v but got %v", tt.want, got)
+			}
+			if got != nil && !errors.Is(got, tt.err) {
+				t.Errorf("expected %v to wrap %v", got, tt.err)
+			}
+			if IsTransient(got) != tt.transient {
+				t.Errorf("expected IsTransient to be %t for %v", tt.transient, got)
+			}
+		})
+	}
+
+	// Cancellation is not classified at all.
+	if got := classify(cancelled, killedErr, nil); got != killedErr {
+		t.Errorf("expected a cancelled error to be unchanged but got %v", got)
+	}
+}
+
+func Test_newEncodeError(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	command := []string{"ffmpeg", "-i", "a.mp4", "a.m3u8"}
+	log := []string{
+		"Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'a.mp4':",
+		"  Duration: 00:00:10.00, start: 0.000000, bitrate: 1000 kb/s",
+		"[libx264 @ 0x1] Error setting profile high444.",
+		"Error initializing output stream 0:0 -- Error while opening encoder",
+		"",
+	}
+
+	err := newEncodeError(command, classify(context.Background(), exitErr, log), log)
+
+	if err.ExitCode != 3 {
+		t.Errorf("expected exit code 3 but got %d", err.ExitCode)
+	}
+	if len(err.Errors) != 2 {
+		t.Errorf("expected 2 error lines but got %d: %q", len(err.Errors), err.Errors)
+	}
+	if !errors.Is(err, exitErr) {
+		t.Error("expected the encode error to wrap the exit error")
+	}
+	want := "ffmpeg: exit status 3: Error initializing output stream 0:0 -- Error while opening encoder"
+	if err.Error() != want {
+		t.Errorf("expected %q but got %q", want, err.Error())
+	}
+
+	// The classification is kept, and the encode error can be found when wrapped.
+	wrapped := fmt.Errorf("encoding: %w", newEncodeError(command, classify(context.Background(), exitErr, []string{"No space left on device"}), nil))
+	var encodeErr *EncodeError
+	if !errors.As(wrapped, &encodeErr) {
+		t.Fatal("expected errors.As to find the encode error")
+	}
+	if !errors.Is(wrapped, ErrDiskFull) {
+		t.Errorf("expected %v to be ErrDiskFull", wrapped)
+	}
+	if encodeErr.ExitCode != 3 || encodeErr.Command[0] != "ffmpeg" {
+		t.Errorf("unexpected encode error %+v", encodeErr)
+	}
+
+	// Key files are not given away.
+	keyed := newEncodeError([]string{"ffmpeg", "-hls_key_info_file", "/secret/enc.keyinfo", "a.m3u8"}, exitErr, nil)
+	if slices.Contains(keyed.Command, "/secret/enc.keyinfo") || len(keyed.Command) != 4 {
+		t.Errorf("expected the key info file to be redacted but got %q", keyed.Command)
+	}
+
+	// Processes which never ran have no exit code.
+	notFound := newEncodeError(command, classify(context.Background(), exec.Command("no-such-ffmpeg").Run(), nil), nil)
+	if notFound.ExitCode != -1 || !errors.Is(notFound, ErrBinaryNotFound) {
+		t.Errorf("unexpected encode error %+v", notFound)
+	}
+}
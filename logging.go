@@ -0,0 +1,78 @@
+package streamer
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+// The keys of the attributes logged with every message about a job.
+const (
+	logVideoID      = "video_id"
+	logEncodingType = "encoding_type"
+	logWorker       = "worker"
+	logAttempt      = "attempt"
+	logDuration     = "duration"
+	logError        = "error"
+)
+
+// redacted replaces sensitive arguments in logged command lines.
+const redacted = "REDACTED"
+
+// sensitiveFlags are the ffmpeg options whose values are never logged, since they are keys
+// or tell you where to find them.
+var sensitiveFlags = []string{
+	"-hls_key_info_file",
+	"-hls_enc_key",
+	"-hls_enc_key_url",
+	"-encryption_key",
+	"-encryption_kid",
+	"-decryption_key",
+	"-cenc_key",
+}
+
+// redactArgs returns a copy of args with the value of every sensitive option replaced.
+func redactArgs(args []string) []string {
+	redactedArgs := slices.Clone(args)
+	for i := 1; i < len(redactedArgs); i++ {
+		if slices.Contains(sensitiveFlags, redactedArgs[i-1]) {
+			redactedArgs[i] = redacted
+		}
+	}
+	return redactedArgs
+}
+
+// discardHandler is a slog.Handler which drops everything, used when no logger is given.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// discardLogger is the logger used when no logger is given.
+var discardLogger = slog.New(discardHandler{})
+
+// logger returns vd.Logger, or a logger which discards everything if it is nil.
+func (vd *VideoDispatcher) logger() *slog.Logger {
+	if vd.Logger == nil {
+		return discardLogger
+	}
+	return vd.Logger
+}
+
+// jobLogger returns the logger of vd, with the attributes which identify job.
+func (vd *VideoDispatcher) jobLogger(job VideoProcessingJob) *slog.Logger {
+	return vd.logger().With(
+		slog.Int(logVideoID, job.Video.ID),
+		slog.String(logEncodingType, job.Video.EncodingType),
+	)
+}
+
+// logger returns ve.Logger, or a logger which discards everything if it is nil.
+func (ve *VideoEncoder) logger() *slog.Logger {
+	if ve.Logger == nil {
+		return discardLogger
+	}
+	return ve.Logger
+}
@@ -0,0 +1,83 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+)
+
+func Test_redactArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "nothing to redact", args: []string{"-i", "a.mp4", "a.m3u8"}, want: []string{"-i", "a.mp4", "a.m3u8"}},
+		{name: "key info", args: []string{"-i", "a.mp4", "-hls_key_info_file", "./keys/enc.keyinfo", "a.m3u8"}, want: []string{"-i", "a.mp4", "-hls_key_info_file", redacted, "a.m3u8"}},
+		{name: "key", args: []string{"-decryption_key", "0123456789abcdef", "-i", "a.mp4"}, want: []string{"-decryption_key", redacted, "-i", "a.mp4"}},
+		{name: "flag last", args: []string{"-i", "a.mp4", "-hls_enc_key"}, want: []string{"-i", "a.mp4", "-hls_enc_key"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := slices.Clone(tt.args)
+			if got := redactArgs(tt.args); !slices.Equal(got, tt.want) {
+				t.Errorf("expected %q but got %q", tt.want, got)
+			}
+			if !slices.Equal(tt.args, original) {
+				t.Error("expected the arguments to be left alone")
+			}
+		})
+	}
+}
+
+func TestVideoDispatcher_Logger(t *testing.T) {
+	engine := testEncoderFunc{fn: func(v *Video) error {
+		if v.ID == 2 {
+			return errors.New("some error")
+		}
+		return nil
+	}}
+	var buf bytes.Buffer
+	wp := New(nil, 1, Processor{Engine: &engine})
+	wp.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	wp.Run()
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	for id := 1; id <= 2; id++ {
+		_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(id, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+		<-notifyChan
+	}
+	wp.Shutdown(context.Background())
+
+	var got []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry map[string]any
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, entry[slog.MessageKey].(string))
+
+		switch entry[slog.MessageKey] {
+		case "job started":
+			if entry[logWorker] != 1.0 || entry[logAttempt] != 1.0 || entry[logEncodingType] != "mp4" {
+				t.Errorf("unexpected attributes %v", entry)
+			}
+		case "job failed":
+			if entry[logVideoID] != 2.0 || entry[logError] != "some error" || entry[slog.LevelKey] != "ERROR" {
+				t.Errorf("unexpected attributes %v", entry)
+			}
+		}
+	}
+
+	// Queued jobs are only logged at debug level.
+	want := []string{"job started", "job succeeded", "job started", "job failed", "shutting down", "shut down"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
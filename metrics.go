@@ -0,0 +1,39 @@
+package streamer
+
+import "time"
+
+// Metrics is an interface for recording what the dispatcher does, e.g. to export it to a
+// monitoring system. A Prometheus implementation is in the promstreamer package. Any type
+// that wants to satisfy this interface must implement all its methods, and be safe for
+// concurrent use. The methods are called while jobs are processed, so they should be quick.
+type Metrics interface {
+	// JobSubmitted is called when the dispatcher takes a job.
+	JobSubmitted(encodingType string)
+	// JobRejected is called when the dispatcher turns a job away with ErrQueueFull.
+	JobRejected(encodingType string)
+	// JobStarted is called when a worker starts an attempt at a job.
+	JobStarted(encodingType string)
+	// JobRetried is called when an attempt at a job fails, and the job is queued again.
+	JobRetried(encodingType string)
+	// JobFinished is called when a job succeeds, fails, or is cancelled. The duration is how
+	// long the last attempt took, and is zero for jobs which were cancelled before they started.
+	// For jobs which succeeded, outputBytes is the size of the output; otherwise it is zero.
+	JobFinished(encodingType string, state JobState, duration time.Duration, outputBytes int64)
+}
+
+// noMetrics is the Metrics used when the dispatcher has none, and does nothing.
+type noMetrics struct{}
+
+func (noMetrics) JobSubmitted(string)                                {}
+func (noMetrics) JobRejected(string)                                 {}
+func (noMetrics) JobStarted(string)                                  {}
+func (noMetrics) JobRetried(string)                                  {}
+func (noMetrics) JobFinished(string, JobState, time.Duration, int64) {}
+
+// metrics returns vd.Metrics, or a Metrics which does nothing if it is nil.
+func (vd *VideoDispatcher) metrics() Metrics {
+	if vd.Metrics == nil {
+		return noMetrics{}
+	}
+	return vd.Metrics
+}
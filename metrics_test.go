@@ -0,0 +1,58 @@
+package streamer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMetrics is a type which satisfies the Metrics interface, and records every call made to it.
+type testMetrics struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (tm *testMetrics) record(format string, args ...any) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.events = append(tm.events, fmt.Sprintf(format, args...))
+}
+
+func (tm *testMetrics) JobSubmitted(encodingType string) { tm.record("submitted %s", encodingType) }
+func (tm *testMetrics) JobRejected(encodingType string)  { tm.record("rejected %s", encodingType) }
+func (tm *testMetrics) JobStarted(encodingType string)   { tm.record("started %s", encodingType) }
+func (tm *testMetrics) JobRetried(encodingType string)   { tm.record("retried %s", encodingType) }
+func (tm *testMetrics) JobFinished(encodingType string, state JobState, duration time.Duration, outputBytes int64) {
+	tm.record("finished %s %s", encodingType, state)
+}
+
+func TestVideoDispatcher_Metrics(t *testing.T) {
+	attempts := 0
+	engine := testEncoderFunc{fn: func(v *Video) error {
+		attempts++
+		if attempts == 1 {
+			return ErrKilled
+		}
+		return nil
+	}}
+	var metrics testMetrics
+	wp := New(nil, 1, Processor{Engine: &engine})
+	wp.Metrics = &metrics
+	wp.Retry = &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "hls", notifyChan, nil)})
+	<-notifyChan
+
+	want := []string{"submitted hls", "started hls", "retried hls", "started hls", "finished hls succeeded"}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if !slices.Equal(metrics.events, want) {
+		t.Errorf("expected %q but got %q", want, metrics.events)
+	}
+}
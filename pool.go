@@ -1,19 +1,58 @@
 package streamer
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrShutdown is the cause given to the context of any encode which is killed because
+// the dispatcher was shut down before the encode could finish.
+var ErrShutdown = errors.New("dispatcher shut down")
+
+// ErrCancelled is the cause given to the context of any encode which is cancelled
+// by calling Cancel on the dispatcher.
+var ErrCancelled = errors.New("encode cancelled")
+
+// ErrQueueFull is returned by Submit, and sent to the NotifyChan of jobs sent to the job
+// queue, when the dispatcher rejects a job because too many are already waiting for a worker.
+var ErrQueueFull = errors.New("job queue full")
+
+// OverflowPolicy says what the dispatcher does with a new job when MaxPending jobs are
+// already waiting for a worker.
+type OverflowPolicy int
+
+const (
+	OverflowBlock  OverflowPolicy = iota // Wait for room. The job queue is not read until there is some.
+	OverflowReject                       // Reject the job with ErrQueueFull.
+)
+
 // VideoProcessingJob is the unit of work to be performed. We wrap this type
 // around a Video, which has all the information we need about the input source
 // and what we want the output to look like.
 type VideoProcessingJob struct {
-	Video Video
+	Video    Video
+	Priority int             // Jobs with a higher priority are given to workers first, e.g. PriorityHigh.
+	ctx      context.Context // Cancelled by VideoDispatcher.Cancel; set once the dispatcher takes the job. Carries the span of the job.
+	wait     trace.Span      // Covers the time the job waits for a worker.
+	worker   int             // The id of the worker running the job, if it is running.
+	handle   uint64          // Tells the job apart from others for the same video; set once the dispatcher takes the job.
+	retire   bool            // If true, this is not a job, but tells the worker which gets it to exit.
 }
 
-// newVideoWorker takes a numeric id and a channel which accepts the chan VideoProcessingJob
-// type, and returns a videoWorker object.
-func newVideoWorker(id int, workerPool chan chan VideoProcessingJob) videoWorker {
+// newVideoWorker takes a numeric id and the dispatcher which owns the worker,
+// and returns a videoWorker object.
+func newVideoWorker(id int, vd *VideoDispatcher) videoWorker {
 	return videoWorker{
 		id:         id,
 		jobQueue:   make(chan VideoProcessingJob),
-		workerPool: workerPool,
+		workerPool: vd.WorkerPool,
+		dispatcher: vd,
 	}
 }
 
@@ -25,56 +64,737 @@ type videoWorker struct {
 	id         int
 	jobQueue   chan VideoProcessingJob      // Where we send jobs to process.
 	workerPool chan chan VideoProcessingJob // Our worker pool channel.
+	dispatcher *VideoDispatcher             // The dispatcher which owns this worker.
 }
 
-// start starts an individual worker.
+// start starts an individual worker. The worker exits once the dispatcher is shut down
+// and it is not running a job, or when it is retired by Resize.
 func (w videoWorker) start() {
 	go func() {
+		defer w.dispatcher.wg.Done()
+
 		for {
 			// Add jobQueue to the worker pool.
-			w.workerPool <- w.jobQueue
+			select {
+			case w.workerPool <- w.jobQueue:
+			case <-w.dispatcher.quit:
+				return
+			}
 
 			// Wait for a job to come back.
-			job := <-w.jobQueue
-
-			// Process the video with a worker.
-			w.processVideoJob(job.Video)
+			select {
+			case job := <-w.jobQueue:
+				if job.retire {
+					return
+				}
+				// Process the video with a worker.
+				w.processVideoJob(job)
+			case <-w.dispatcher.quit:
+				return
+			}
 		}
 	}()
 }
 
+// jobCancels cancels the jobs taken for one video, keyed by job handle.
+type jobCancels map[uint64]context.CancelCauseFunc
+
 // VideoDispatcher holds info for a dispatcher.
 type VideoDispatcher struct {
-	WorkerPool chan chan VideoProcessingJob // Our worker pool channel.
-	maxWorkers int                          // The maximum number of workers in our pool.
-	jobQueue   chan VideoProcessingJob      // The channel we send work to.
-	Processor  Processor
+	WorkerPool     chan chan VideoProcessingJob // Our worker pool channel.
+	maxWorkers     int                          // The number of workers in our pool; protected by mu once running.
+	jobQueue       chan VideoProcessingJob      // The channel we send work to.
+	Processor      Processor
+	Store          JobStore                // If not nil, where jobs are persisted so that they can be recovered.
+	Retry          *RetryPolicy            // If not nil, how failed encodes are retried.
+	Metrics        Metrics                 // If not nil, where what the dispatcher does is recorded.
+	TracerProvider trace.TracerProvider    // If not nil, used to trace every job.
+	Logger         *slog.Logger            // If not nil, where what happens to each job is logged.
+	Autoscale      *AutoscalePolicy        // If not nil, how the number of workers is changed to suit the load. Set before Run.
+	running        bool                    // Set by Run.
+	lastWorkerID   int                     // The id of the last worker started.
+	retiring       int                     // How many workers are still to be retired.
+	paused         bool                    // If true, no jobs are given to workers.
+	Aging          time.Duration           // How long a job waits to gain one level of priority. If zero, ten minutes.
+	MaxPending     int                     // If above zero, the most jobs which may wait for a worker. Set before Run.
+	Overflow       OverflowPolicy          // What to do with new jobs when MaxPending jobs are waiting.
+	Timeout        time.Duration           // If above zero, how long an attempt at a job may take, unless its options say otherwise.
+	StallTimeout   time.Duration           // If above zero, how long ffmpeg may go without reporting progress, unless the options of the job say otherwise.
+	KeepFinished   time.Duration           // How long the status of a finished job is kept. If zero, one hour.
+	MaxFinished    int                     // The most finished jobs whose status is kept, dropping those which finished first. If zero, 1000.
+	pending        pendingQueue            // Jobs waiting for a worker.
+	wake           chan struct{}           // Signalled when a job is added to pending.
+	slots          chan struct{}           // Holds a token for each job in pending, if MaxPending is set.
+	space          chan struct{}           // Signalled when a job leaves pending.
+	closed         bool                    // Set once Shutdown has emptied pending, after which nothing may be added.
+	quit           chan struct{}           // Closed when the dispatcher is shut down.
+	quitOnce       sync.Once               // Makes sure we only close quit once.
+	ctx            context.Context         // Parent of every running encode; cancelled to kill them.
+	cancel         context.CancelCauseFunc // Cancels ctx.
+	wg             sync.WaitGroup          // Tracks workers, the dispatcher, and jobs waiting to be retried.
+	mu             sync.Mutex              // Protects pending, closed, paused, abandoned, and cancels.
+	abandoned      []VideoProcessingJob    // Jobs taken from the queue which were never completed.
+	cancels        map[int]jobCancels      // Cancels jobs taken from the queue, keyed by video ID and then by job handle.
+	lastHandle     uint64                  // The handle of the last job taken.
+	statusMu       sync.Mutex              // Protects statuses.
+	statuses       map[int]*JobStatus      // The status of every job taken, keyed by video ID.
 }
 
 // Run runs the workers.
 func (vd *VideoDispatcher) Run() {
+	if vd.MaxPending > 0 {
+		vd.slots = make(chan struct{}, vd.MaxPending)
+	}
+
+	vd.mu.Lock()
+	vd.running = true
 	for i := 0; i < vd.maxWorkers; i++ {
-		worker := newVideoWorker(i+1, vd.WorkerPool)
-		worker.start()
+		vd.startWorker()
 	}
+	vd.mu.Unlock()
 
+	vd.wg.Add(2)
+	go vd.receive()
 	go vd.dispatch()
+
+	if vd.Autoscale != nil {
+		vd.wg.Add(1)
+		go vd.autoscale(vd.Autoscale)
+	}
 }
 
-// dispatch dispatches a worker.
-func (vd *VideoDispatcher) dispatch() {
+// Shutdown stops the dispatcher from taking any more jobs from the job queue, and waits
+// for running encodes to finish. If ctx is done before they do, the running encodes are
+// killed and Shutdown returns ctx.Err(). Jobs which were taken from the job queue but
+// never completed, either because they were still waiting for a worker or because their
+// encode was killed, are returned so that the caller can requeue them; no message is sent
+// to the NotifyChan of those jobs. Once ctx is done, results which nobody has read from a
+// NotifyChan are dropped. Jobs still sitting in the job queue are left there.
+// Jobs which were waiting for a worker are returned in the order they would have run.
+func (vd *VideoDispatcher) Shutdown(ctx context.Context) ([]VideoProcessingJob, error) {
+	vd.quitOnce.Do(func() {
+		vd.logger().Info("shutting down")
+		close(vd.quit)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		vd.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// We ran out of time, so kill whatever is still running, and wait for the
+		// workers to notice.
+		err = ctx.Err()
+		vd.cancel(ErrShutdown)
+		<-done
+	}
+	vd.cancel(ErrShutdown)
+
+	// Nothing else is running now, so whatever is still waiting for a worker will never get one.
+	vd.mu.Lock()
+	vd.closed = true
+	var waiting []VideoProcessingJob
+	for job, ok := vd.pending.pop(); ok; job, ok = vd.pending.pop() {
+		waiting = append(waiting, job)
+	}
+	vd.mu.Unlock()
+	for _, job := range waiting {
+		vd.release()
+		vd.abandon(job)
+	}
+
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+	abandoned := vd.abandoned
+	vd.abandoned = nil
+	vd.logger().Info("shut down", slog.Int("abandoned", len(abandoned)))
+
+	return abandoned, err
+}
+
+// receive takes jobs from the job queue, and adds them to the jobs waiting for a worker.
+func (vd *VideoDispatcher) receive() {
+	defer vd.wg.Done()
+
 	for {
+		// Leave jobs in the job queue until there is room for them, so that whoever is
+		// sending them is held back.
+		for vd.Overflow == OverflowBlock && vd.full() {
+			select {
+			case <-vd.space:
+			case <-vd.quit:
+				return
+			}
+		}
+
 		// Wait for a job to come in.
-		job := <-vd.jobQueue
+		var job VideoProcessingJob
+		var ok bool
+		select {
+		case job, ok = <-vd.jobQueue:
+			if !ok {
+				// The job queue was closed, so there is nothing more to do until we shut down.
+				<-vd.quit
+				return
+			}
+		case <-vd.quit:
+			return
+		}
+
+		switch err := vd.admit(context.Background(), job, vd.Overflow == OverflowBlock); {
+		case errors.Is(err, ErrQueueFull):
+			// Report the rejection without waiting for the client to read it, so that the
+			// job queue keeps moving. The job was never taken, so the report is given up
+			// as soon as we shut down.
+			job.Video.abort = vd.quit
+			vd.wg.Add(1)
+			go func() {
+				defer vd.wg.Done()
+				job.Video.sendFailure(err)
+			}()
+		case err != nil:
+			// We shut down while waiting for room.
+			vd.abandon(job)
+			return
+		}
+	}
+}
+
+// Submit adds job to the jobs waiting for a worker, just as sending it to the job queue does,
+// but returns an error if the job can't be taken. If MaxPending jobs are already waiting, then
+// with OverflowReject, Submit returns ErrQueueFull straight away; with OverflowBlock, it waits
+// for room, and returns ctx.Err() if ctx is done first. Jobs which are waiting for room are
+// taken in the order they were submitted. If the dispatcher has been shut down, Submit
+// returns ErrShutdown. If Validate is set in the options of the video, the input is checked
+// first, and the error from Validate is returned if it fails, without the job ever being queued.
+func (vd *VideoDispatcher) Submit(ctx context.Context, job VideoProcessingJob) error {
+	if job.Video.Options != nil && job.Video.Options.Validate {
+		if err := job.Video.Validate(ctx); err != nil {
+			return err
+		}
+		job.Video.validated = true
+	}
+
+	return vd.admit(ctx, job, vd.Overflow == OverflowBlock)
+}
+
+// admit takes a slot for job, waiting for one if wait is true, and adds the job to the jobs
+// waiting for a worker.
+func (vd *VideoDispatcher) admit(ctx context.Context, job VideoProcessingJob, wait bool) error {
+	select {
+	case <-vd.quit:
+		return ErrShutdown
+	default:
+	}
+
+	if err := vd.acquire(ctx, wait); err != nil {
+		if errors.Is(err, ErrQueueFull) {
+			vd.metrics().JobRejected(job.Video.EncodingType)
+			vd.jobLogger(job).Warn("job rejected", slog.Any(logError, err))
+		}
+		return err
+	}
+
+	job = vd.track(job)
+	vd.metrics().JobSubmitted(job.Video.EncodingType)
+	if !vd.enqueue(job) {
+		// We shut down after all, so make sure the job isn't recovered when the caller has
+		// been told it was never taken.
+		vd.untrack(job)
+		vd.record(job, JobCancelled, ErrShutdown.Error())
+		vd.metrics().JobFinished(job.Video.EncodingType, JobCancelled, 0, 0)
+		endJobSpan(job, JobCancelled, ErrShutdown)
+		return ErrShutdown
+	}
+	vd.jobLogger(job).Debug("job queued", slog.Int("priority", job.Priority))
+
+	return nil
+}
+
+// full returns true if MaxPending jobs are waiting for a worker.
+func (vd *VideoDispatcher) full() bool {
+	return vd.slots != nil && len(vd.slots) == cap(vd.slots)
+}
+
+// acquire takes a slot in pending for a job. If there is none free, it waits for one if wait
+// is true, and returns ErrQueueFull if not. It returns ctx.Err() if ctx is done, or ErrShutdown
+// if the dispatcher is shut down, before a slot is free.
+func (vd *VideoDispatcher) acquire(ctx context.Context, wait bool) error {
+	if vd.slots == nil {
+		return nil
+	}
+
+	if !wait {
+		select {
+		case vd.slots <- struct{}{}:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	}
+
+	select {
+	case vd.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-vd.quit:
+		return ErrShutdown
+	}
+}
+
+// release gives back the slot of a job which has left pending.
+func (vd *VideoDispatcher) release() {
+	if vd.slots == nil {
+		return
+	}
+	<-vd.slots
+
+	// Let receive know there is room, unless it already knows.
+	select {
+	case vd.space <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch waits for a worker to be free, and gives it the waiting job with the highest
+// priority, until the dispatcher is shut down.
+func (vd *VideoDispatcher) dispatch() {
+	defer vd.wg.Done()
+
+	for {
+		var workerJobQueue chan VideoProcessingJob
+		select {
+		case workerJobQueue = <-vd.WorkerPool: // assign a channel from our worker pool to workerJobQueue.
+		case <-vd.quit:
+			return
+		}
+
+		job, ok := vd.next()
+		if !ok {
+			return
+		}
+		if !job.retire {
+			vd.release()
+		}
+
+		select {
+		case workerJobQueue <- job: // Send the unit of work to our queue.
+		case <-vd.quit:
+			// We shut down before the worker could take the job.
+			if !job.retire {
+				vd.abandon(job)
+			}
+			return
+		}
+	}
+}
+
+// next waits for a job to be added to pending, and removes and returns the one with the
+// highest priority. While the dispatcher is paused, it waits for it to be resumed. If a worker
+// is to be retired, it returns a job which tells the worker to exit instead. It returns false
+// if the dispatcher is shut down first.
+func (vd *VideoDispatcher) next() (VideoProcessingJob, bool) {
+	for {
+		vd.mu.Lock()
+		if vd.retiring > 0 {
+			vd.retiring--
+			vd.mu.Unlock()
+			return VideoProcessingJob{retire: true}, true
+		}
+		var job VideoProcessingJob
+		var ok bool
+		if !vd.paused {
+			job, ok = vd.pending.pop()
+		}
+		vd.mu.Unlock()
+		if ok {
+			return job, true
+		}
+
+		select {
+		case <-vd.wake:
+		case <-vd.quit:
+			return VideoProcessingJob{}, false
+		}
+	}
+}
+
+// enqueue adds job, which holds a slot, to the jobs waiting for a worker. If the job has already
+// been cancelled, it is reported as such instead. It returns false if the dispatcher has been
+// shut down, and can't take the job.
+func (vd *VideoDispatcher) enqueue(job VideoProcessingJob) bool {
+	vd.mu.Lock()
+	if vd.closed {
+		vd.mu.Unlock()
+		vd.release()
+		return false
+	}
+	if job.ctx.Err() != nil {
+		vd.mu.Unlock()
+		vd.release()
+		vd.cancelWaiting(job)
+		return true
+	}
+	vd.pending.push(job, vd.Aging)
+	vd.mu.Unlock()
+
+	// Wake the dispatcher, unless it has already been woken.
+	select {
+	case vd.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// retry queues a job which failed with err again, once the backoff given by the retry policy
+// has passed.
+func (vd *VideoDispatcher) retry(job VideoProcessingJob, err error) {
+	vd.record(job, JobQueued, "")
+	delay := vd.Retry.backoff(job.Video.attempts)
+	vd.jobLogger(job).Warn("job failed, retrying",
+		slog.Int(logAttempt, job.Video.attempts),
+		slog.Duration("backoff", delay),
+		slog.Any(logError, err),
+	)
+	_, job.wait = vd.tracer().Start(job.ctx, spanWait)
+
+	vd.wg.Add(1)
+	go func() {
+		defer vd.wg.Done()
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-job.ctx.Done():
+			vd.cancelWaiting(job)
+			return
+		case <-vd.quit:
+			vd.abandon(job)
+			return
+		}
 
+		// The job has already been taken, so it waits for room whatever the overflow policy.
+		switch err := vd.acquire(job.ctx, true); {
+		case errors.Is(err, ErrShutdown):
+			vd.abandon(job)
+		case err != nil:
+			vd.cancelWaiting(job)
+		default:
+			vd.enqueue(job)
+		}
+	}()
+}
+
+// Cancel cancels the job for the video with the given id. If the video is still waiting
+// for a worker it is never encoded; if it is being encoded, ffmpeg is killed and any partial
+// output is removed. Either way, a message with Cancelled set to true is sent to the NotifyChan
+// of the video. If the dispatcher has taken more than one job for the video, such as an HLS
+// encode and a preview, all of them are cancelled. Cancel returns false if the dispatcher has
+// not taken a job for that video from the job queue, or the jobs have already finished.
+func (vd *VideoDispatcher) Cancel(id int) bool {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+
+	cancels, ok := vd.cancels[id]
+	if !ok {
+		return false
+	}
+	for _, cancel := range cancels {
+		cancel(ErrCancelled)
+	}
+	delete(vd.cancels, id)
+
+	// If any of the jobs are waiting for a worker, take them out of the queue and report them
+	// now, rather than leaving them until a worker is free.
+	for job, ok := vd.pending.remove(id); ok; job, ok = vd.pending.remove(id) {
+		vd.release()
+		vd.wg.Add(1)
 		go func() {
-			workerJobQueue := <-vd.WorkerPool // assign a channel from our worker pool to workerJobPool.
-			workerJobQueue <- job             // Send the unit of work to our queue.
+			defer vd.wg.Done()
+			vd.cancelWaiting(job)
 		}()
 	}
+
+	return true
+}
+
+// Recover reads the unfinished jobs from vd.Store, and queues them again, with their results
+// sent to notifyChan. It is meant to be called once, just after Run, when the process starts,
+// to pick up the jobs which were queued or running when the process last stopped. If MaxPending
+// is set, Recover waits for room for each job, whatever the overflow policy. The number of jobs
+// queued is returned.
+func (vd *VideoDispatcher) Recover(notifyChan chan ProcessingMessage) (int, error) {
+	if vd.Store == nil {
+		return 0, nil
+	}
+
+	records, err := vd.Store.Unfinished()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, rec := range records {
+		v := vd.NewVideo(rec.ID, rec.InputFile, rec.OutputDir, rec.EncodingType, notifyChan, rec.Options)
+		if err := vd.admit(context.Background(), VideoProcessingJob{Video: v, Priority: rec.Priority}, true); err != nil {
+			return i, err
+		}
+	}
+
+	return len(records), nil
+}
+
+// track records a job taken by the dispatcher as queued, gives it a context which is cancelled
+// by Cancel, and makes it give up sending its result if a shutdown is forced. It returns the job.
+func (vd *VideoDispatcher) track(job VideoProcessingJob) VideoProcessingJob {
+	vd.record(job, JobQueued, "")
+
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+
+	// The span of the job is a child of any span in the context of the video, but the job
+	// isn't cancelled with that context until it starts.
+	_, span := vd.tracer().Start(job.Video.Context(), spanJob, trace.WithAttributes(
+		attrVideoID.Int(job.Video.ID),
+		attrEncodingType.String(job.Video.EncodingType),
+		attrPriority.Int(job.Priority),
+	))
+	ctx, cancel := context.WithCancelCause(trace.ContextWithSpan(context.Background(), span))
+	job.ctx = ctx
+	_, job.wait = vd.tracer().Start(ctx, spanWait)
+	vd.lastHandle++
+	job.handle = vd.lastHandle
+	if vd.cancels[job.Video.ID] == nil {
+		vd.cancels[job.Video.ID] = jobCancels{}
+	}
+	vd.cancels[job.Video.ID][job.handle] = cancel
+
+	// Once a shutdown is forced, nobody may be reading the notify channel, so results are
+	// dropped rather than holding up the workers.
+	job.Video.abort = vd.ctx.Done()
+
+	return job
 }
 
-// processVideoJob processes the main queue job.
-func (w videoWorker) processVideoJob(video Video) {
-	video.encode()
+// record records the state of job in the status registry, and in vd.Store.
+func (vd *VideoDispatcher) record(job VideoProcessingJob, state JobState, message string) {
+	vd.setStatus(job, state, message)
+	vd.save(job, state, message)
+}
+
+// save records the state of job in vd.Store, if there is one. Once the job has finished, its
+// record is deleted instead, since it will never be recovered. Persistence is best effort:
+// if the store fails, the error is logged and the job carries on regardless.
+func (vd *VideoDispatcher) save(job VideoProcessingJob, state JobState, message string) {
+	if vd.Store == nil {
+		return
+	}
+
+	if state.Finished() {
+		if err := vd.Store.Delete(job.Video.ID); err != nil {
+			vd.jobLogger(job).Warn("deleting job failed", slog.String("state", string(state)), slog.Any(logError, err))
+		}
+		return
+	}
+	if err := vd.Store.Save(newJobRecord(job, state, message)); err != nil {
+		vd.jobLogger(job).Warn("saving job failed", slog.String("state", string(state)), slog.Any(logError, err))
+	}
+}
+
+// untrack forgets a job once it is done with.
+func (vd *VideoDispatcher) untrack(job VideoProcessingJob) {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+
+	// Other jobs for the same video may still be running, so only this one is forgotten.
+	cancels := vd.cancels[job.Video.ID]
+	if cancel, ok := cancels[job.handle]; ok {
+		cancel(nil)
+		delete(cancels, job.handle)
+		if len(cancels) == 0 {
+			delete(vd.cancels, job.Video.ID)
+		}
+	}
+}
+
+// cancelWaiting reports that a job which was still waiting for a worker has been cancelled.
+func (vd *VideoDispatcher) cancelWaiting(job VideoProcessingJob) {
+	vd.untrack(job)
+	vd.record(job, JobCancelled, ErrCancelled.Error())
+	vd.metrics().JobFinished(job.Video.EncodingType, JobCancelled, 0, 0)
+	endJobSpan(job, JobCancelled, ErrCancelled)
+	vd.jobLogger(job).Info("job cancelled before it started")
+	job.Video.sendCancelled()
+}
+
+// abandon records a job which was taken from the job queue but never completed.
+func (vd *VideoDispatcher) abandon(job VideoProcessingJob) {
+	vd.untrack(job)
+	// The job is handed back to the caller, so it is no longer ours to report on, but it stays
+	// queued in the store so that it can be recovered.
+	vd.dropStatus(job.Video.ID)
+	vd.save(job, JobQueued, "")
+	endJobSpan(job, JobQueued, nil)
+	vd.jobLogger(job).Info("job abandoned")
+
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+	job.ctx = nil
+	job.wait = nil
+	vd.abandoned = append(vd.abandoned, job)
+}
+
+// processVideoJob processes the main queue job. The encode is killed if the job
+// is cancelled, or the dispatcher is shut down before it finishes, or if it times out. If the
+// encode fails, or times out, and the retry policy of the dispatcher allows it, the job is
+// queued again.
+func (w videoWorker) processVideoJob(job VideoProcessingJob) {
+	job.wait.End()
+	job.Video.attempts++
+	video := job.Video
+
+	ctx, cancel := context.WithCancelCause(video.Context())
+	defer cancel(nil)
+	for _, parent := range []context.Context{job.ctx, w.dispatcher.ctx} {
+		parent := parent
+		stop := context.AfterFunc(parent, func() {
+			cancel(context.Cause(parent))
+		})
+		defer stop()
+	}
+	video.onProgress = w.dispatcher.setProgress
+	job.worker = w.id
+
+	timeout, stall := w.dispatcher.Timeout, w.dispatcher.StallTimeout
+	if video.Options != nil {
+		if video.Options.Timeout > 0 {
+			timeout = video.Options.Timeout
+		}
+		if video.Options.StallTimeout > 0 {
+			stall = video.Options.StallTimeout
+		}
+	}
+	video.stallTimeout = stall
+	if timeout > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", ErrTimeout, timeout))
+		defer stop()
+	}
+
+	// The span of the attempt is a child of the span of the job, and is carried by the
+	// context of the video so that the encoder can add to it.
+	ctx, span := w.dispatcher.tracer().Start(trace.ContextWithSpan(ctx, trace.SpanFromContext(job.ctx)), spanEncode, trace.WithAttributes(
+		attrWorker.Int(w.id),
+		attrAttempt.Int(video.attempts),
+	))
+	video.ctx = ctx
+
+	log := w.dispatcher.jobLogger(job).With(slog.Int(logWorker, w.id), slog.Int(logAttempt, video.attempts))
+	log.Info("job started")
+
+	w.dispatcher.record(job, JobRunning, "")
+	w.dispatcher.metrics().JobStarted(video.EncodingType)
+	started := time.Now()
+	fileNames, err := video.run()
+	duration := time.Since(started)
+	job.worker = 0
+
+	if len(video.renditionNames) > 0 {
+		span.SetAttributes(attrRenditions.StringSlice(video.renditionNames))
+		trace.SpanFromContext(job.ctx).SetAttributes(attrRenditions.StringSlice(video.renditionNames))
+	}
+
+	// An attempt which runs out of time has failed, rather than been cancelled, whatever the
+	// encoder makes of it.
+	timedOut := errors.Is(context.Cause(ctx), ErrTimeout)
+	if err != nil && timedOut && !errors.Is(err, ErrTimeout) {
+		err = fmt.Errorf("%w: %w", context.Cause(ctx), err)
+	}
+	endSpan(span, err)
+
+	// The status is updated before the client is told, so that it is up to date by the time
+	// the client asks, but the job is only saved as finished once the client has been told.
+	var state JobState
+	var message string
+	switch {
+	case err == nil:
+		state = JobSucceeded
+	case errors.Is(context.Cause(ctx), ErrShutdown):
+		w.dispatcher.abandon(job)
+		return
+	case ctx.Err() != nil && !timedOut:
+		state, message = JobCancelled, context.Cause(ctx).Error()
+	case w.dispatcher.Retry.shouldRetry(video.attempts, err):
+		w.dispatcher.metrics().JobRetried(video.EncodingType)
+		w.dispatcher.retry(job, err)
+		return
+	default:
+		state, message = JobFailed, err.Error()
+	}
+
+	var outputBytes int64
+	if state == JobSucceeded {
+		outputBytes = video.outputSize()
+	}
+	w.dispatcher.setStatus(job, state, message)
+	w.dispatcher.metrics().JobFinished(video.EncodingType, state, duration, outputBytes)
+	endJobSpan(job, state, err)
+	switch state {
+	case JobSucceeded:
+		log.Info("job succeeded", slog.Duration(logDuration, duration), slog.Int64("output_bytes", outputBytes))
+	case JobCancelled:
+		log.Info("job cancelled", slog.Duration(logDuration, duration), slog.String("cause", message))
+	default:
+		log.Error("job failed", slog.Duration(logDuration, duration), slog.Any(logError, err))
+	}
+	video.notify(fileNames, err)
+	w.dispatcher.save(job, state, message)
+	w.dispatcher.untrack(job)
+}
+
+// Pause stops the dispatcher from giving jobs to workers. Running encodes carry on, and jobs
+// are still taken from the job queue and by Submit, and wait until Resume is called (subject
+// to MaxPending). Waiting jobs can still be cancelled.
+func (vd *VideoDispatcher) Pause() {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+
+	if !vd.paused {
+		vd.paused = true
+		vd.logger().Info("paused")
+	}
+}
+
+// Resume lets the dispatcher give jobs to workers again after Pause.
+func (vd *VideoDispatcher) Resume() {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+
+	if !vd.paused {
+		return
+	}
+	vd.paused = false
+	vd.logger().Info("resumed")
+
+	// Wake the dispatcher, in case jobs are waiting.
+	select {
+	case vd.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Paused returns true if the dispatcher is paused.
+func (vd *VideoDispatcher) Paused() bool {
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+
+	return vd.paused
 }
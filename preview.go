@@ -0,0 +1,194 @@
+package streamer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PreviewOptions says how to make the short looping preview of a video encoded with the
+// "preview" encoding type. The preview is either one clip, or a montage of clips spread
+// evenly through the video.
+type PreviewOptions struct {
+	Format   string        // The format of the preview: "webp" or "gif". If empty, "webp".
+	Start    time.Duration // Where in the video the clip starts. Not used for a montage.
+	Duration time.Duration // How long the preview is, in total. If zero, 3 seconds.
+	Segments int           // If above one, the preview is a montage of this many clips.
+	Width    int           // The width of the preview in pixels. If zero, 320. The height keeps the aspect ratio.
+	FPS      int           // The frame rate of the preview. If zero, 10.
+	MP4      bool          // If true, a silent MP4 of the preview is written as well.
+}
+
+// previewOptions returns the preview options of v, or the defaults if it has none.
+func (v *Video) previewOptions() *PreviewOptions {
+	if v.Options.Preview == nil {
+		return &PreviewOptions{}
+	}
+	return v.Options.Preview
+}
+
+// format returns the format of the preview, with the default filled in.
+func (o *PreviewOptions) format() string {
+	if o.Format == "" {
+		return "webp"
+	}
+	return o.Format
+}
+
+// duration returns how long the preview is, with the default filled in.
+func (o *PreviewOptions) duration() time.Duration {
+	if o.Duration == 0 {
+		return 3 * time.Second
+	}
+	return o.Duration
+}
+
+// width returns the width of the preview, with the default filled in.
+func (o *PreviewOptions) width() int {
+	if o.Width == 0 {
+		return 320
+	}
+	return o.Width
+}
+
+// fps returns the frame rate of the preview, with the default filled in.
+func (o *PreviewOptions) fps() int {
+	if o.FPS == 0 {
+		return 10
+	}
+	return o.FPS
+}
+
+// validate returns an error matching ErrInvalidInput if o can't be used.
+func (o *PreviewOptions) validate() error {
+	switch {
+	case o.format() != "webp" && o.format() != "gif":
+		return fmt.Errorf("%w: invalid preview format %q", ErrInvalidInput, o.Format)
+	case o.Start < 0 || o.duration() < 0:
+		return fmt.Errorf("%w: invalid preview clip %s long from %s", ErrInvalidInput, o.Duration, o.Start)
+	case o.Segments < 0:
+		return fmt.Errorf("%w: invalid preview segment count %d", ErrInvalidInput, o.Segments)
+	case o.width() < 0 || o.fps() < 0:
+		return fmt.Errorf("%w: invalid preview size %d at %d fps", ErrInvalidInput, o.Width, o.FPS)
+	}
+	return nil
+}
+
+// fileNames returns the names of the files of the preview with the given base file name, the
+// first of which is the animation.
+func (o *PreviewOptions) fileNames(baseFileName string) []string {
+	names := []string{fmt.Sprintf("%s.%s", baseFileName, o.format())}
+	if o.MP4 {
+		names = append(names, fmt.Sprintf("%s.mp4", baseFileName))
+	}
+	return names
+}
+
+// previewClip is a part of the input used in a preview.
+type previewClip struct {
+	start    time.Duration
+	duration time.Duration
+}
+
+// clips returns the parts of a video of the given duration which make up the preview: either
+// the one clip starting at Start, or Segments clips spread evenly through the video.
+func (o *PreviewOptions) clips(duration time.Duration) []previewClip {
+	if o.Segments <= 1 {
+		return []previewClip{{start: o.Start, duration: o.duration()}}
+	}
+
+	length := o.duration() / time.Duration(o.Segments)
+	clips := make([]previewClip, o.Segments)
+	for i, at := range thumbnailTimes(duration, o.Segments) {
+		clips[i] = previewClip{start: at, duration: length}
+	}
+	return clips
+}
+
+// previewArgs returns the arguments for ffmpeg to make the preview of v from the given clips.
+// Each clip is read as a separate input, so that ffmpeg can seek straight to it, and the clips
+// are joined together. A GIF only has 256 colours, so a palette is made for it from the clips
+// themselves.
+func previewArgs(v *Video, baseFileName string, o *PreviewOptions, clips []previewClip) []string {
+	args := []string{"-y"}
+	for _, c := range clips {
+		args = append(args, "-ss", seconds(c.start), "-t", seconds(c.duration), "-i", v.InputFile)
+	}
+
+	var filters []string
+	if len(clips) == 1 {
+		filters = append(filters, fmt.Sprintf("[0:v:0]fps=%d,scale=%d:-2:flags=lanczos,setsar=1[preview]", o.fps(), o.width()))
+	} else {
+		var joined strings.Builder
+		for i := range clips {
+			filters = append(filters, fmt.Sprintf("[%d:v:0]fps=%d,scale=%d:-2:flags=lanczos,setsar=1[c%d]", i, o.fps(), o.width(), i))
+			fmt.Fprintf(&joined, "[c%d]", i)
+		}
+		filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=0[preview]", joined.String(), len(clips)))
+	}
+
+	// The joined clips are split between the palette, the animation, and the MP4, as needed.
+	outputs := []string{"[out]"}
+	if o.format() == "gif" {
+		outputs = []string{"[palette]", "[anim]"}
+	}
+	if o.MP4 {
+		outputs = append(outputs, "[mp4]")
+	}
+	out := "[out]"
+	if len(outputs) > 1 {
+		filters = append(filters, fmt.Sprintf("[preview]split=%d%s", len(outputs), strings.Join(outputs, "")))
+	} else {
+		out = "[preview]"
+	}
+	if o.format() == "gif" {
+		filters = append(filters,
+			"[palette]palettegen=stats_mode=diff[p]",
+			"[anim][p]paletteuse=dither=bayer:bayer_scale=5:diff_mode=rectangle[out]",
+		)
+	}
+
+	args = append(args, "-filter_complex", strings.Join(filters, ";"), "-map", out)
+	if o.format() == "webp" {
+		args = append(args, "-c:v", "libwebp", "-quality", "75")
+	}
+	args = append(args, "-loop", "0", fmt.Sprintf("%s/%s.%s", v.OutputDir, baseFileName, o.format()))
+
+	if o.MP4 {
+		args = append(args,
+			"-map", "[mp4]",
+			"-c:v", "libx264",
+			"-pix_fmt", "yuv420p", // Plays everywhere.
+			"-movflags", "+faststart",
+			fmt.Sprintf("%s/%s.mp4", v.OutputDir, baseFileName),
+		)
+	}
+
+	return args
+}
+
+// EncodeToPreview takes a Video object and a base file name, and makes a short looping preview
+// as an animated WebP or GIF, and optionally a silent MP4, as set in v.Options.Preview.
+// The ffmpeg process is killed if the context of v is cancelled.
+func (ve *VideoEncoder) EncodeToPreview(v *Video, baseFileName string) error {
+	o := v.previewOptions()
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	info, err := Probe(v.Context(), v.InputFile)
+	if err != nil {
+		return err
+	}
+	if info.VideoStream() == nil {
+		return fmt.Errorf("%s: %w: %w", v.InputFile, ErrInvalidInput, ErrNoVideoStream)
+	}
+	if o.Segments > 1 && info.Duration <= 0 {
+		return fmt.Errorf("%w: the duration of the input is unknown", ErrInvalidInput)
+	}
+	if info.Duration > 0 && o.Start >= info.Duration {
+		return fmt.Errorf("%w: preview start %s is after the end of the video", ErrInvalidInput, o.Start)
+	}
+
+	return ve.runFFmpeg(v, previewArgs(v, baseFileName, o, o.clips(info.Duration))...)
+}
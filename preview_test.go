@@ -0,0 +1,82 @@
+package streamer
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviewOptions_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     PreviewOptions
+		wantErr bool
+	}{
+		{name: "defaults", ops: PreviewOptions{}},
+		{name: "gif montage", ops: PreviewOptions{Format: "gif", Segments: 4, Duration: 4 * time.Second}},
+		{name: "bad format", ops: PreviewOptions{Format: "apng"}, wantErr: true},
+		{name: "negative start", ops: PreviewOptions{Start: -time.Second}, wantErr: true},
+		{name: "negative segments", ops: PreviewOptions{Segments: -2}, wantErr: true},
+		{name: "negative width", ops: PreviewOptions{Width: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ops.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %t but got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("expected %v to be ErrInvalidInput", err)
+			}
+		})
+	}
+}
+
+func TestPreviewOptions_clips(t *testing.T) {
+	single := (&PreviewOptions{Start: 5 * time.Second}).clips(time.Minute)
+	if !slices.Equal(single, []previewClip{{start: 5 * time.Second, duration: 3 * time.Second}}) {
+		t.Errorf("unexpected clips %v", single)
+	}
+
+	montage := (&PreviewOptions{Segments: 3, Duration: 6 * time.Second}).clips(80 * time.Second)
+	want := []previewClip{
+		{start: 20 * time.Second, duration: 2 * time.Second},
+		{start: 40 * time.Second, duration: 2 * time.Second},
+		{start: 60 * time.Second, duration: 2 * time.Second},
+	}
+	if !slices.Equal(montage, want) {
+		t.Errorf("expected %v but got %v", want, montage)
+	}
+}
+
+func Test_previewArgs(t *testing.T) {
+	v := Video{InputFile: "./a/b.mp4", OutputDir: "./testdata/output"}
+
+	ops := &PreviewOptions{Start: 5 * time.Second}
+	cmd := strings.Join(previewArgs(&v, "b", ops, ops.clips(time.Minute)), " ")
+	want := "-y -ss 5.000 -t 3.000 -i ./a/b.mp4 -filter_complex [0:v:0]fps=10,scale=320:-2:flags=lanczos,setsar=1[preview] " +
+		"-map [preview] -c:v libwebp -quality 75 -loop 0 ./testdata/output/b.webp"
+	if cmd != want {
+		t.Errorf("expected %q but got %q", want, cmd)
+	}
+
+	ops = &PreviewOptions{Format: "gif", Segments: 2, MP4: true}
+	cmd = strings.Join(previewArgs(&v, "b", ops, ops.clips(time.Minute)), " ")
+	for _, want := range []string{
+		"-ss 20.000 -t 1.500 -i ./a/b.mp4 -ss 40.000 -t 1.500 -i ./a/b.mp4 ",
+		"[c0][c1]concat=n=2:v=1:a=0[preview];[preview]split=3[palette][anim][mp4];[palette]palettegen",
+		"-map [out] -loop 0 ./testdata/output/b.gif",
+		"-map [mp4] -c:v libx264 -pix_fmt yuv420p -movflags +faststart ./testdata/output/b.mp4",
+	} {
+		if !strings.Contains(cmd, want) {
+			t.Errorf("expected command to contain %q but got %q", want, cmd)
+		}
+	}
+
+	if names := ops.fileNames("b"); !slices.Equal(names, []string{"b.gif", "b.mp4"}) {
+		t.Errorf("unexpected file names %v", names)
+	}
+}
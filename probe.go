@@ -0,0 +1,275 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoVideoStream is returned when validating an input file which has no video stream. It also
+// matches ErrInvalidInput.
+var ErrNoVideoStream = errors.New("no video stream")
+
+// ErrUnsupportedCodec is returned when validating an input file whose video is in a codec
+// which cannot be decoded, or which is not in VideoOptions.AllowedCodecs. It also matches
+// ErrInvalidInput.
+var ErrUnsupportedCodec = errors.New("unsupported codec")
+
+// MediaInfo describes a media file, as reported by ffprobe.
+type MediaInfo struct {
+	Container string        // The container format(s), e.g. "mov,mp4,m4a,3gp,3g2,mj2".
+	Duration  time.Duration // The duration of the file.
+	Bitrate   int64         // The overall bitrate, in bits per second.
+	Size      int64         // The size of the file, in bytes.
+	Streams   []StreamInfo  // The streams in the file.
+}
+
+// StreamInfo describes one stream of a media file. Fields which don't apply to the
+// type of the stream are left empty.
+type StreamInfo struct {
+	Index          int     // The index of the stream in the file.
+	Type           string  // The type of stream: "video", "audio", "subtitle", "data", or "attachment".
+	Codec          string  // The name of the codec, e.g. "h264" or "aac".
+	Profile        string  // The codec profile, e.g. "High".
+	Bitrate        int64   // The bitrate, in bits per second.
+	Language       string  // The language tag, e.g. "eng".
+	Width          int     // The width of the video, as stored (i.e. before rotation).
+	Height         int     // The height of the video, as stored (i.e. before rotation).
+	FrameRate      float64 // Frames per second.
+	Rotation       int     // Rotation in degrees, from the display matrix or rotate tag.
+	PixelFormat    string  // The pixel format, e.g. "yuv420p10le".
+	ColorSpace     string  // The color space, e.g. "bt2020nc".
+	ColorTransfer  string  // The transfer characteristics, e.g. "smpte2084".
+	ColorPrimaries string  // The color primaries, e.g. "bt2020".
+	HDR            bool    // True if the video uses an HDR transfer function (PQ or HLG).
+	AttachedPic    bool    // True if the video is a still image, such as cover art, rather than a video.
+	Channels       int     // The number of audio channels.
+	ChannelLayout  string  // The audio channel layout, e.g. "stereo".
+	SampleRate     int     // The audio sample rate, in Hz.
+}
+
+// DisplayWidth returns the width of the video as displayed, taking rotation into account.
+func (s StreamInfo) DisplayWidth() int {
+	if s.quarterTurn() {
+		return s.Height
+	}
+	return s.Width
+}
+
+// DisplayHeight returns the height of the video as displayed, taking rotation into account.
+func (s StreamInfo) DisplayHeight() int {
+	if s.quarterTurn() {
+		return s.Width
+	}
+	return s.Height
+}
+
+// quarterTurn returns true if the video is rotated by 90 or 270 degrees, which ffmpeg
+// undoes when encoding, swapping the dimensions.
+func (s StreamInfo) quarterTurn() bool {
+	r := ((s.Rotation % 360) + 360) % 360
+	return r == 90 || r == 270
+}
+
+// VideoStream returns the first video stream which is not a still image, or nil if there isn't one.
+func (m *MediaInfo) VideoStream() *StreamInfo {
+	for i := range m.Streams {
+		if m.Streams[i].Type == "video" && !m.Streams[i].AttachedPic {
+			return &m.Streams[i]
+		}
+	}
+	return nil
+}
+
+// AudioStream returns the first audio stream, or nil if there isn't one.
+func (m *MediaInfo) AudioStream() *StreamInfo {
+	for i := range m.Streams {
+		if m.Streams[i].Type == "audio" {
+			return &m.Streams[i]
+		}
+	}
+	return nil
+}
+
+// Probe runs ffprobe on the file at path, and returns information about it.
+func Probe(ctx context.Context, path string) (*MediaInfo, error) {
+	var stdout, stderr bytes.Buffer
+	ffprobeCmd := exec.CommandContext(ctx,
+		"ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	)
+	ffprobeCmd.Stdout = &stdout
+	ffprobeCmd.Stderr = &stderr
+
+	if err := ffprobeCmd.Run(); err != nil {
+		err = classify(ctx, err, strings.Split(stderr.String(), "\n"))
+		return nil, fmt.Errorf("error probing %s: %w: %s", path, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	info, err := parseProbeOutput(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error probing %s: %w: %w", path, ErrInvalidInput, err)
+	}
+
+	return info, nil
+}
+
+// ffprobeOutput is the subset of the JSON written by ffprobe which we use.
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+		Size       string `json:"size"`
+	} `json:"format"`
+	Streams []struct {
+		Index          int               `json:"index"`
+		CodecType      string            `json:"codec_type"`
+		CodecName      string            `json:"codec_name"`
+		Profile        string            `json:"profile"`
+		BitRate        string            `json:"bit_rate"`
+		Width          int               `json:"width"`
+		Height         int               `json:"height"`
+		AvgFrameRate   string            `json:"avg_frame_rate"`
+		RFrameRate     string            `json:"r_frame_rate"`
+		PixFmt         string            `json:"pix_fmt"`
+		ColorSpace     string            `json:"color_space"`
+		ColorTransfer  string            `json:"color_transfer"`
+		ColorPrimaries string            `json:"color_primaries"`
+		Channels       int               `json:"channels"`
+		ChannelLayout  string            `json:"channel_layout"`
+		SampleRate     string            `json:"sample_rate"`
+		Disposition    map[string]int    `json:"disposition"`
+		Tags           map[string]string `json:"tags"`
+		SideDataList   []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+}
+
+// parseProbeOutput turns the JSON written by ffprobe into a MediaInfo.
+func parseProbeOutput(data []byte) (*MediaInfo, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+
+	info := MediaInfo{
+		Container: out.Format.FormatName,
+		Bitrate:   parseInt(out.Format.BitRate),
+		Size:      parseInt(out.Format.Size),
+	}
+	if seconds, err := strconv.ParseFloat(out.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	for _, s := range out.Streams {
+		stream := StreamInfo{
+			Index:          s.Index,
+			Type:           s.CodecType,
+			Codec:          s.CodecName,
+			Profile:        s.Profile,
+			Bitrate:        parseInt(s.BitRate),
+			Language:       s.Tags["language"],
+			Width:          s.Width,
+			Height:         s.Height,
+			FrameRate:      parseFrameRate(s.AvgFrameRate),
+			PixelFormat:    s.PixFmt,
+			ColorSpace:     s.ColorSpace,
+			ColorTransfer:  s.ColorTransfer,
+			ColorPrimaries: s.ColorPrimaries,
+			HDR:            s.ColorTransfer == "smpte2084" || s.ColorTransfer == "arib-std-b67",
+			AttachedPic:    s.Disposition["attached_pic"] == 1,
+			Channels:       s.Channels,
+			ChannelLayout:  s.ChannelLayout,
+			SampleRate:     int(parseInt(s.SampleRate)),
+		}
+		if stream.FrameRate == 0 {
+			stream.FrameRate = parseFrameRate(s.RFrameRate)
+		}
+
+		if r, err := strconv.Atoi(s.Tags["rotate"]); err == nil {
+			stream.Rotation = r
+		}
+		for _, sd := range s.SideDataList {
+			if sd.Rotation != 0 {
+				stream.Rotation = int(math.Round(sd.Rotation))
+			}
+		}
+
+		info.Streams = append(info.Streams, stream)
+	}
+
+	return &info, nil
+}
+
+// Validate probes the input file of v, and returns an error wrapping ErrNoVideoStream if it
+// has no video stream, or ErrUnsupportedCodec if the video cannot be decoded or its codec is
+// not in v.Options.AllowedCodecs. Calling Validate before queueing a video means that bad
+// inputs are rejected without occupying a worker.
+func (v *Video) Validate(ctx context.Context) error {
+	info, err := Probe(ctx, v.InputFile)
+	if err != nil {
+		return err
+	}
+
+	return v.validate(info)
+}
+
+// validate checks the probed information about the input file of v.
+func (v *Video) validate(info *MediaInfo) error {
+	stream := info.VideoStream()
+	if stream == nil {
+		return fmt.Errorf("%s: %w: %w", v.InputFile, ErrInvalidInput, ErrNoVideoStream)
+	}
+
+	if stream.Codec == "" || stream.Codec == "none" || stream.Codec == "unknown" {
+		return fmt.Errorf("%s: %w: %w", v.InputFile, ErrInvalidInput, ErrUnsupportedCodec)
+	}
+
+	if v.Options != nil && len(v.Options.AllowedCodecs) > 0 && !slices.Contains(v.Options.AllowedCodecs, stream.Codec) {
+		return fmt.Errorf("%s: %w: %w %s", v.InputFile, ErrInvalidInput, ErrUnsupportedCodec, stream.Codec)
+	}
+
+	return nil
+}
+
+// parseInt parses a number written by ffprobe as a string, returning 0 if it is missing or invalid.
+func parseInt(s string) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseFrameRate parses a frame rate written by ffprobe as a fraction, e.g. "30000/1001".
+func parseFrameRate(s string) float64 {
+	num, den, found := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !found {
+		return n
+	}
+
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+
+	return n / d
+}
@@ -0,0 +1,175 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testProbeOutput is trimmed output from ffprobe for a rotated phone video with HDR video,
+// stereo audio, and cover art.
+const testProbeOutput = `{
+	"streams": [
+		{
+			"index": 0,
+			"codec_name": "hevc",
+			"profile": "Main 10",
+			"codec_type": "video",
+			"width": 1920,
+			"height": 1080,
+			"pix_fmt": "yuv420p10le",
+			"color_space": "bt2020nc",
+			"color_transfer": "arib-std-b67",
+			"color_primaries": "bt2020",
+			"r_frame_rate": "30/1",
+			"avg_frame_rate": "30000/1001",
+			"bit_rate": "8000000",
+			"disposition": {"default": 1, "attached_pic": 0},
+			"tags": {"language": "und"},
+			"side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]
+		},
+		{
+			"index": 1,
+			"codec_name": "aac",
+			"codec_type": "audio",
+			"sample_rate": "48000",
+			"channels": 2,
+			"channel_layout": "stereo",
+			"bit_rate": "128000",
+			"disposition": {"default": 1, "attached_pic": 0},
+			"tags": {"language": "eng"}
+		},
+		{
+			"index": 2,
+			"codec_name": "mjpeg",
+			"codec_type": "video",
+			"width": 600,
+			"height": 600,
+			"disposition": {"default": 0, "attached_pic": 1}
+		}
+	],
+	"format": {
+		"format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+		"duration": "12.500000",
+		"size": "12641056",
+		"bit_rate": "8090275"
+	}
+}`
+
+func Test_parseProbeOutput(t *testing.T) {
+	info, err := parseProbeOutput([]byte(testProbeOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Container != "mov,mp4,m4a,3gp,3g2,mj2" || info.Duration != 12500*time.Millisecond || info.Size != 12641056 || info.Bitrate != 8090275 {
+		t.Errorf("unexpected format information: %+v", info)
+	}
+	if len(info.Streams) != 3 {
+		t.Fatalf("expected 3 streams but got %d", len(info.Streams))
+	}
+
+	video := info.VideoStream()
+	if video == nil || video.Index != 0 {
+		t.Fatalf("expected the first stream to be the video stream but got %+v", video)
+	}
+	if video.Codec != "hevc" || !video.HDR || video.Rotation != -90 || video.Bitrate != 8000000 {
+		t.Errorf("unexpected video stream: %+v", video)
+	}
+	if video.DisplayWidth() != 1080 || video.DisplayHeight() != 1920 {
+		t.Errorf("expected rotated dimensions of 1080x1920 but got %dx%d", video.DisplayWidth(), video.DisplayHeight())
+	}
+	if video.FrameRate < 29.97 || video.FrameRate > 29.98 {
+		t.Errorf("expected a frame rate of 29.97 but got %v", video.FrameRate)
+	}
+
+	audio := info.AudioStream()
+	if audio == nil || audio.Channels != 2 || audio.SampleRate != 48000 || audio.Language != "eng" {
+		t.Errorf("unexpected audio stream: %+v", audio)
+	}
+
+	if !info.Streams[2].AttachedPic {
+		t.Error("expected the cover art to be an attached picture")
+	}
+
+	if _, err := parseProbeOutput([]byte("not json")); err == nil {
+		t.Error("expected an error for invalid output")
+	}
+}
+
+func TestVideo_validate(t *testing.T) {
+	info, err := parseProbeOutput([]byte(testProbeOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audioOnly := &MediaInfo{Streams: []StreamInfo{info.Streams[1], info.Streams[2]}}
+	unknown := &MediaInfo{Streams: []StreamInfo{{Type: "video", Codec: "none"}}}
+
+	tests := []struct {
+		name    string
+		info    *MediaInfo
+		ops     *VideoOptions
+		wantErr error
+	}{
+		{name: "valid", info: info, ops: &VideoOptions{}},
+		{name: "allowed codec", info: info, ops: &VideoOptions{AllowedCodecs: []string{"h264", "hevc"}}},
+		{name: "disallowed codec", info: info, ops: &VideoOptions{AllowedCodecs: []string{"h264"}}, wantErr: ErrUnsupportedCodec},
+		{name: "unknown codec", info: unknown, ops: &VideoOptions{}, wantErr: ErrUnsupportedCodec},
+		{name: "no video", info: audioOnly, ops: &VideoOptions{}, wantErr: ErrNoVideoStream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Video{InputFile: "a.mp4", Options: tt.ops}
+			err := v.validate(tt.info)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("expected %v but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVideoDispatcher_Submit_validate(t *testing.T) {
+	// A stand-in for ffprobe which finds only an audio stream.
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho '{\"streams\": [{\"codec_type\": \"audio\", \"codec_name\": \"aac\"}], \"format\": {}}'\n"
+	if err := os.WriteFile(filepath.Join(bin, "ffprobe"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	wp := New(nil, 1, testProcessor)
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	ops := &VideoOptions{Validate: true}
+	v := wp.NewVideo(1, "./a/b.m4a", "./testdata/output", "mp4", testNotifyChan, ops)
+	if err := wp.Submit(context.Background(), VideoProcessingJob{Video: v}); !errors.Is(err, ErrNoVideoStream) {
+		t.Errorf("expected ErrNoVideoStream but got %v", err)
+	}
+	if _, ok := wp.Status(1); ok {
+		t.Error("expected the job not to be taken")
+	}
+}
+
+func Test_parseFrameRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{in: "30/1", want: 30},
+		{in: "25", want: 25},
+		{in: "0/0", want: 0},
+		{in: "", want: 0},
+		{in: "x/1", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseFrameRate(tt.in); got != tt.want {
+			t.Errorf("parseFrameRate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package streamer
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressMessage is sent to the ProgressChan of a video while it is being encoded.
+type ProgressMessage struct {
+	ID        int           `json:"id"`        // The ID of the video.
+	Percent   float64       `json:"percent"`   // How much of the input has been encoded, from 0 to 100.
+	OutTime   time.Duration `json:"out_time"`  // How much of the input has been encoded, as a duration.
+	FPS       float64       `json:"fps"`       // Frames encoded per second.
+	Speed     float64       `json:"speed"`     // Encoding speed as a multiple of real time, e.g. 2.5.
+	Remaining time.Duration `json:"remaining"` // The estimated time until the encode is finished.
+	Done      bool          `json:"done"`      // True for the last message of an encode.
+}
+
+// durationRegex matches the duration of the input, as printed by ffmpeg on stderr,
+// e.g. "  Duration: 00:01:02.50, start: 0.000000, bitrate: 1205 kb/s".
+var durationRegex = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// progressParser turns the output of ffmpeg into progress messages for a video.
+type progressParser struct {
+	video    *Video
+	duration atomic.Int64    // The duration of the input; 0 until it is known.
+	current  ProgressMessage // The message being built from the current block of progress output.
+	log      []string        // The last logTailLines lines of log output.
+	seen     func()          // If not nil, called for every block of progress output.
+}
+
+// logTailLines is how many lines at the end of the log output of ffmpeg we keep.
+const logTailLines = 50
+
+// newProgressParser returns a progressParser for v.
+func newProgressParser(v *Video) *progressParser {
+	return &progressParser{
+		video:   v,
+		current: ProgressMessage{ID: v.ID},
+	}
+}
+
+// readLog reads the log output of ffmpeg from r, looking for the duration of the input,
+// and keeping the last few lines.
+func (p *progressParser) readLog(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		p.parseLogLine(line)
+
+		p.log = append(p.log, line)
+		if len(p.log) > logTailLines {
+			p.log = p.log[1:]
+		}
+	}
+
+	// If scanning stopped early, e.g. on a line too long for the scanner, keep reading, or
+	// ffmpeg blocks writing to the pipe and never exits.
+	_, _ = io.Copy(io.Discard, r)
+}
+
+// parseLogLine records the duration of the input if line contains it. Only the first
+// duration is used, since that is the one for the input file.
+func (p *progressParser) parseLogLine(line string) {
+	if p.duration.Load() > 0 {
+		return
+	}
+
+	m := durationRegex.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.ParseFloat(m[3], 64)
+	d := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+	p.duration.Store(int64(d))
+}
+
+// readProgress reads the output of "-progress -" from r, and sends a progress message to
+// the video for every block of output.
+func (p *progressParser) readProgress(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if msg, ok := p.parseProgressLine(scanner.Text()); ok {
+			if p.seen != nil {
+				p.seen()
+			}
+			p.video.sendProgress(msg)
+		}
+	}
+
+	// As with the log, the rest has to be read even if it can't be parsed.
+	_, _ = io.Copy(io.Discard, r)
+}
+
+// parseProgressLine parses one key=value line of progress output. ffmpeg ends each block of
+// output with a "progress" key, at which point the completed message is returned along with true.
+func (p *progressParser) parseProgressLine(line string) (ProgressMessage, bool) {
+	key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+	if !found {
+		return ProgressMessage{}, false
+	}
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "out_time_us", "out_time_ms": // Despite the name, out_time_ms is also in microseconds.
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+			p.current.OutTime = time.Duration(us) * time.Microsecond
+		}
+	case "fps":
+		if fps, err := strconv.ParseFloat(value, 64); err == nil {
+			p.current.FPS = fps
+		}
+	case "speed":
+		if speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+			p.current.Speed = speed
+		}
+	case "progress":
+		msg := p.current
+		msg.Done = value == "end"
+
+		if duration := time.Duration(p.duration.Load()); duration > 0 {
+			msg.Percent = min(100, 100*float64(msg.OutTime)/float64(duration))
+			if msg.Speed > 0 && msg.OutTime < duration {
+				msg.Remaining = time.Duration(float64(duration-msg.OutTime) / msg.Speed)
+			}
+		}
+		if msg.Done {
+			msg.Percent = 100
+			msg.Remaining = 0
+		}
+
+		return msg, true
+	}
+
+	return ProgressMessage{}, false
+}
@@ -0,0 +1,125 @@
+package streamer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_progressParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		log      string
+		progress string
+		want     []ProgressMessage
+	}{
+		{
+			name:     "with duration",
+			log:      "Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'dog.mp4':\n  Duration: 00:00:10.00, start: 0.000000, bitrate: 1205 kb/s\n",
+			progress: "frame=50\nfps=25.00\nout_time_us=2500000\nspeed=1.25x\nprogress=continue\nframe=250\nfps=25.00\nout_time_us=10000000\nspeed=1.3x\nprogress=end\n",
+			want: []ProgressMessage{
+				{ID: 1, Percent: 25, OutTime: 2500 * time.Millisecond, FPS: 25, Speed: 1.25, Remaining: 6 * time.Second},
+				{ID: 1, Percent: 100, OutTime: 10 * time.Second, FPS: 25, Speed: 1.3, Done: true},
+			},
+		},
+		{
+			name:     "without duration",
+			log:      "",
+			progress: "fps=30\nout_time_ms=1000000\nspeed=N/A\nprogress=continue\n",
+			want: []ProgressMessage{
+				{ID: 1, OutTime: time.Second, FPS: 30},
+			},
+		},
+		{
+			name:     "negative out time",
+			log:      "  Duration: 01:00:00.00, start: 0.000000\n",
+			progress: "out_time_us=-9223372036854775807\nprogress=continue\n",
+			want: []ProgressMessage{
+				{ID: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progressChan := make(chan ProgressMessage, 10)
+			v := Video{ID: 1, ProgressChan: progressChan}
+
+			p := newProgressParser(&v)
+			p.readLog(strings.NewReader(tt.log))
+			p.readProgress(strings.NewReader(tt.progress))
+			close(progressChan)
+
+			var got []ProgressMessage
+			for msg := range progressChan {
+				got = append(got, msg)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d messages but got %d", len(tt.want), len(got))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("message %d: expected %+v but got %+v", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_progressParser_longLine(t *testing.T) {
+	// A line too long for the scanner mustn't stop the pipes being read to the end.
+	long := strings.Repeat("x", 1<<20) + "\nprogress=end\n"
+	v := Video{ID: 1}
+	p := newProgressParser(&v)
+
+	log := strings.NewReader(long)
+	p.readLog(log)
+	progress := strings.NewReader(long)
+	p.readProgress(progress)
+
+	if log.Len() != 0 || progress.Len() != 0 {
+		t.Errorf("expected both readers to be drained but %d and %d bytes are left", log.Len(), progress.Len())
+	}
+}
+
+func Test_sendProgress(t *testing.T) {
+	v := Video{ID: 1}
+
+	// No channel, so nothing should happen.
+	v.sendProgress(ProgressMessage{ID: 1})
+
+	// A full channel should not block.
+	v.ProgressChan = make(chan ProgressMessage, 1)
+	v.sendProgress(ProgressMessage{ID: 1, Percent: 10})
+	v.sendProgress(ProgressMessage{ID: 1, Percent: 20})
+
+	if msg := <-v.ProgressChan; msg.Percent != 10 {
+		t.Errorf("expected the first message to be kept but got %+v", msg)
+	}
+}
+
+func TestVideoEncoder_stall(t *testing.T) {
+	// A stand-in for ffmpeg which reports progress once, and then hangs.
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho progress=continue\nexec sleep 10\n"
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	v := Video{ID: 1, Options: &VideoOptions{}, stallTimeout: 100 * time.Millisecond}
+	var ve VideoEncoder
+
+	started := time.Now()
+	err := ve.runFFmpeg(&v, "-i", "a.mp4", "-progress", "-", "a.mp4")
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout but got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected ffmpeg to be killed but it ran for %s", elapsed)
+	}
+}
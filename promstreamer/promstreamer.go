@@ -0,0 +1,163 @@
+// Package promstreamer exports the metrics of a streamer worker pool to Prometheus.
+//
+//	wp := streamer.New(videoQueue, 3)
+//	c := promstreamer.NewCollector(wp)
+//	wp.Metrics = c
+//	prometheus.MustRegister(c)
+package promstreamer
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsawler/streamer"
+)
+
+// namespace prefixes the name of every metric.
+const namespace = "streamer"
+
+// Collector is a prometheus.Collector for a streamer.VideoDispatcher, which also satisfies
+// streamer.Metrics. Counts and durations are recorded as jobs are processed, when the
+// Collector is set as the Metrics of the dispatcher; the state of the queue and workers is
+// read from the dispatcher whenever the Collector is scraped.
+type Collector struct {
+	dispatcher  *streamer.VideoDispatcher
+	submitted   *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+	retried     *prometheus.CounterVec
+	finished    *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	outputBytes *prometheus.CounterVec
+	workers     *prometheus.Desc
+	busyWorkers *prometheus.Desc
+	pending     *prometheus.Desc
+	queued      *prometheus.Desc
+	paused      *prometheus.Desc
+}
+
+// NewCollector returns a Collector for vd. It still has to be set as vd.Metrics, and
+// registered with a prometheus.Registerer.
+func NewCollector(vd *streamer.VideoDispatcher) *Collector {
+	byType := []string{"encoding_type"}
+	byTypeAndState := []string{"encoding_type", "state"}
+
+	return &Collector{
+		dispatcher: vd,
+		submitted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_submitted_total",
+			Help:      "Jobs taken by the dispatcher.",
+		}, byType),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_rejected_total",
+			Help:      "Jobs turned away because the queue was full.",
+		}, byType),
+		retried: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_retried_total",
+			Help:      "Failed attempts at jobs which were queued again.",
+		}, byType),
+		finished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_finished_total",
+			Help:      "Jobs which succeeded, failed, or were cancelled.",
+		}, byTypeAndState),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "encode_duration_seconds",
+			Help:      "How long the last attempt at each finished job took.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 14), // From one second to a little over two hours.
+		}, byTypeAndState),
+		outputBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "output_bytes_total",
+			Help:      "Bytes of output written by jobs which succeeded.",
+		}, byType),
+		workers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "workers"),
+			"The number of workers.", nil, nil),
+		busyWorkers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "busy_workers"),
+			"Workers running an encode.", nil, nil),
+		pending: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "pending_jobs"),
+			"Jobs waiting for a worker.", nil, nil),
+		queued: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "queued_jobs"),
+			"Jobs queued, including those waiting to be retried.", nil, nil),
+		paused: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "paused"),
+			"1 if the dispatcher is paused, otherwise 0.", nil, nil),
+	}
+}
+
+// Describe sends the descriptors of all the metrics of c to ch.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.submitted.Describe(ch)
+	c.rejected.Describe(ch)
+	c.retried.Describe(ch)
+	c.finished.Describe(ch)
+	c.duration.Describe(ch)
+	c.outputBytes.Describe(ch)
+	ch <- c.workers
+	ch <- c.busyWorkers
+	ch <- c.pending
+	ch <- c.queued
+	ch <- c.paused
+}
+
+// Collect sends all the metrics of c to ch.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.submitted.Collect(ch)
+	c.rejected.Collect(ch)
+	c.retried.Collect(ch)
+	c.finished.Collect(ch)
+	c.duration.Collect(ch)
+	c.outputBytes.Collect(ch)
+
+	stats := c.dispatcher.Stats()
+	ch <- prometheus.MustNewConstMetric(c.workers, prometheus.GaugeValue, float64(stats.Workers))
+	ch <- prometheus.MustNewConstMetric(c.busyWorkers, prometheus.GaugeValue, float64(stats.BusyWorkers))
+	ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(stats.Pending))
+	ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(stats.Queued))
+
+	paused := 0.0
+	if stats.Paused {
+		paused = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.paused, prometheus.GaugeValue, paused)
+}
+
+// JobSubmitted counts a job taken by the dispatcher.
+func (c *Collector) JobSubmitted(encodingType string) {
+	c.submitted.WithLabelValues(encodingType).Inc()
+}
+
+// JobRejected counts a job turned away by the dispatcher.
+func (c *Collector) JobRejected(encodingType string) {
+	c.rejected.WithLabelValues(encodingType).Inc()
+}
+
+// JobStarted does nothing, since running jobs are counted from the dispatcher when scraped.
+func (c *Collector) JobStarted(encodingType string) {}
+
+// JobRetried counts a failed attempt at a job which was queued again.
+func (c *Collector) JobRetried(encodingType string) {
+	c.retried.WithLabelValues(encodingType).Inc()
+}
+
+// JobFinished counts a finished job, and records how long it took and how much output it wrote.
+func (c *Collector) JobFinished(encodingType string, state streamer.JobState, duration time.Duration, outputBytes int64) {
+	c.finished.WithLabelValues(encodingType, string(state)).Inc()
+	if duration > 0 {
+		c.duration.WithLabelValues(encodingType, string(state)).Observe(duration.Seconds())
+	}
+	c.outputBytes.WithLabelValues(encodingType).Add(float64(outputBytes))
+}
+
+// Check that Collector satisfies both interfaces.
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+	_ streamer.Metrics     = (*Collector)(nil)
+)
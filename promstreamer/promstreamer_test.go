@@ -0,0 +1,109 @@
+package promstreamer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tsawler/streamer"
+)
+
+// testEncoder is a type which satisfies the streamer.Encoder interface. Encodes to MP4 write
+// 100 bytes of output, and everything else fails.
+type testEncoder struct{}
+
+func (te *testEncoder) EncodeToMP4(v *streamer.Video, baseFileName string) error {
+	return os.WriteFile(filepath.Join(v.OutputDir, baseFileName+".mp4"), make([]byte, 100), 0644)
+}
+
+func (te *testEncoder) EncodeToHLS(v *streamer.Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+func (te *testEncoder) EncodeToHLSEncrypted(v *streamer.Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+func (te *testEncoder) EncodeToDASH(v *streamer.Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+func (te *testEncoder) EncodeToCMAF(v *streamer.Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+func (te *testEncoder) EncodeToPreview(v *streamer.Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+func (te *testEncoder) EncodeThumbnails(v *streamer.Video, baseFileName string) error {
+	return nil
+}
+
+func (te *testEncoder) EncodeSprites(v *streamer.Video, baseFileName string) error {
+	return nil
+}
+
+func TestCollector(t *testing.T) {
+	wp := streamer.New(nil, 2, streamer.Processor{Engine: &testEncoder{}})
+	c := NewCollector(wp)
+	wp.Metrics = c
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	notifyChan := make(chan streamer.ProcessingMessage, 10)
+	for id, encType := range []string{"mp4", "mp4", "hls"} {
+		v := wp.NewVideo(id+1, "./a/b.mp4", dir, encType, notifyChan, nil)
+		if err := wp.Submit(context.Background(), streamer.VideoProcessingJob{Video: v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		<-notifyChan
+	}
+
+	expected := `
+# HELP streamer_jobs_finished_total Jobs which succeeded, failed, or were cancelled.
+# TYPE streamer_jobs_finished_total counter
+streamer_jobs_finished_total{encoding_type="hls",state="failed"} 1
+streamer_jobs_finished_total{encoding_type="mp4",state="succeeded"} 2
+# HELP streamer_jobs_submitted_total Jobs taken by the dispatcher.
+# TYPE streamer_jobs_submitted_total counter
+streamer_jobs_submitted_total{encoding_type="hls"} 1
+streamer_jobs_submitted_total{encoding_type="mp4"} 2
+# HELP streamer_output_bytes_total Bytes of output written by jobs which succeeded.
+# TYPE streamer_output_bytes_total counter
+streamer_output_bytes_total{encoding_type="hls"} 0
+streamer_output_bytes_total{encoding_type="mp4"} 200
+# HELP streamer_paused 1 if the dispatcher is paused, otherwise 0.
+# TYPE streamer_paused gauge
+streamer_paused 0
+# HELP streamer_pending_jobs Jobs waiting for a worker.
+# TYPE streamer_pending_jobs gauge
+streamer_pending_jobs 0
+# HELP streamer_workers The number of workers.
+# TYPE streamer_workers gauge
+streamer_workers 2
+`
+	err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"streamer_jobs_finished_total", "streamer_jobs_submitted_total", "streamer_output_bytes_total",
+		"streamer_paused", "streamer_pending_jobs", "streamer_workers")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(c, "streamer_encode_duration_seconds"); n != 2 {
+		t.Errorf("expected 2 duration histograms but got %d", n)
+	}
+}
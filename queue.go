@@ -0,0 +1,99 @@
+package streamer
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Priorities for VideoProcessingJob. Any int can be used; jobs with a higher priority are
+// given to workers first.
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// defaultAging is how long a job has to wait to be treated as one level of priority higher,
+// if the dispatcher doesn't say otherwise.
+const defaultAging = 10 * time.Minute
+
+// pendingJob is a job waiting in a pendingQueue.
+type pendingJob struct {
+	job VideoProcessingJob
+	due time.Time // When the job was queued, brought forward by its priority.
+	seq uint64    // The order the job was queued in, so that ties are broken first come, first served.
+}
+
+// pendingQueue holds the jobs which are waiting for a worker, highest priority first. To stop
+// low priority jobs from waiting forever, a job is treated as though it had been queued one
+// aging period earlier for each level of priority, so a job which has waited long enough is
+// always taken before one that has just been queued with a higher priority. It is not safe
+// for concurrent use.
+type pendingQueue struct {
+	jobs pendingHeap
+	seq  uint64
+}
+
+// push adds job to the queue, where each level of priority is worth waiting for aging.
+func (q *pendingQueue) push(job VideoProcessingJob, aging time.Duration) {
+	if aging <= 0 {
+		aging = defaultAging
+	}
+
+	q.seq++
+	heap.Push(&q.jobs, pendingJob{
+		job: job,
+		due: time.Now().Add(-time.Duration(job.Priority) * aging),
+		seq: q.seq,
+	})
+}
+
+// pop removes and returns the job which should run next, and false if the queue is empty.
+func (q *pendingQueue) pop() (VideoProcessingJob, bool) {
+	if len(q.jobs) == 0 {
+		return VideoProcessingJob{}, false
+	}
+	return heap.Pop(&q.jobs).(pendingJob).job, true
+}
+
+// remove removes and returns the job for the video with the given id, and false if there
+// is no such job in the queue.
+func (q *pendingQueue) remove(id int) (VideoProcessingJob, bool) {
+	for i, p := range q.jobs {
+		if p.job.Video.ID == id {
+			heap.Remove(&q.jobs, i)
+			return p.job, true
+		}
+	}
+	return VideoProcessingJob{}, false
+}
+
+// len returns the number of jobs in the queue.
+func (q *pendingQueue) len() int {
+	return len(q.jobs)
+}
+
+// pendingHeap implements heap.Interface for pendingQueue.
+type pendingHeap []pendingJob
+
+func (h pendingHeap) Len() int { return len(h) }
+
+func (h pendingHeap) Less(i, j int) bool {
+	if !h[i].due.Equal(h[j].due) {
+		return h[i].due.Before(h[j].due)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h pendingHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *pendingHeap) Push(x any) { *h = append(*h, x.(pendingJob)) }
+
+func (h *pendingHeap) Pop() any {
+	old := *h
+	n := len(old)
+	p := old[n-1]
+	old[n-1] = pendingJob{}
+	*h = old[:n-1]
+	return p
+}
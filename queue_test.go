@@ -0,0 +1,75 @@
+package streamer
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_pendingQueue(t *testing.T) {
+	job := func(id, priority int) VideoProcessingJob {
+		return VideoProcessingJob{Video: Video{ID: id}, Priority: priority}
+	}
+
+	tests := []struct {
+		name  string
+		jobs  []VideoProcessingJob
+		aging time.Duration
+		wait  time.Duration // How long to wait after queueing the first job.
+		want  []int
+	}{
+		{name: "first come first served", jobs: []VideoProcessingJob{job(1, 0), job(2, 0), job(3, 0)}, want: []int{1, 2, 3}},
+		{name: "priority", jobs: []VideoProcessingJob{job(1, PriorityLow), job(2, PriorityNormal), job(3, PriorityHigh), job(4, PriorityHigh)}, want: []int{3, 4, 2, 1}},
+		{name: "aged", jobs: []VideoProcessingJob{job(1, PriorityLow), job(2, PriorityHigh)}, aging: 5 * time.Millisecond, wait: 15 * time.Millisecond, want: []int{1, 2}},
+		{name: "not aged enough", jobs: []VideoProcessingJob{job(1, PriorityLow), job(2, PriorityHigh)}, aging: time.Hour, wait: 15 * time.Millisecond, want: []int{2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q pendingQueue
+			for i, j := range tt.jobs {
+				q.push(j, tt.aging)
+				if i == 0 {
+					time.Sleep(tt.wait)
+				}
+			}
+
+			var got []int
+			for {
+				j, ok := q.pop()
+				if !ok {
+					break
+				}
+				got = append(got, j.Video.ID)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v but got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v but got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func Test_pendingQueue_remove(t *testing.T) {
+	var q pendingQueue
+	for id := 1; id <= 3; id++ {
+		q.push(VideoProcessingJob{Video: Video{ID: id}}, 0)
+	}
+
+	if _, ok := q.remove(4); ok {
+		t.Error("expected remove to return false for an unknown video")
+	}
+	if j, ok := q.remove(2); !ok || j.Video.ID != 2 {
+		t.Errorf("expected to remove video 2 but got %d", j.Video.ID)
+	}
+	if q.len() != 2 {
+		t.Errorf("expected 2 jobs left but got %d", q.len())
+	}
+	if j, _ := q.pop(); j.Video.ID != 1 {
+		t.Errorf("expected video 1 but got %d", j.Video.ID)
+	}
+}
@@ -0,0 +1,123 @@
+package streamer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rendition describes one rung of the adaptive bitrate ladder used for HLS, DASH, and
+// CMAF encoding. Only Height is required; everything else has a sensible default.
+type Rendition struct {
+	Name         string // The name used in file names and playlists, e.g. "1080p". Defaults to the height followed by "p".
+	Height       int    // The height of the video in pixels. The width is scaled to keep the aspect ratio.
+	VideoBitrate string // The target video bitrate, e.g. "5000k". If empty, quality is controlled by the CRF alone.
+	MaxRate      string // The maximum video bitrate, e.g. "1200k".
+	BufSize      string // The rate control buffer size, e.g. "2400k".
+	AudioBitrate string // The audio bitrate. Defaults to 128k.
+	Profile      string // The H.264 profile. Defaults to baseline, which is compatible with most devices.
+	Level        string // The H.264 level. Defaults to 3.0.
+}
+
+// defaultRenditions returns the ladder we use when none is specified in the video options:
+// 1080p, 720p, and 480p, at the maximum rates given in ops.
+func defaultRenditions(ops *VideoOptions) []Rendition {
+	return []Rendition{
+		{Name: "1080p", Height: 1080, MaxRate: ops.MaxRate1080p, AudioBitrate: "128k"},
+		{Name: "720p", Height: 720, MaxRate: ops.MaxRate720p, AudioBitrate: "128k"},
+		{Name: "480p", Height: 480, MaxRate: ops.MaxRate480p, AudioBitrate: "64k"},
+	}
+}
+
+// renditions returns the ladder to encode v to, with defaults filled in.
+func (v *Video) renditions() ([]Rendition, error) {
+	ladder := v.Options.Renditions
+	if len(ladder) == 0 {
+		ladder = defaultRenditions(v.Options)
+	}
+
+	renditions := make([]Rendition, 0, len(ladder))
+	names := make(map[string]bool)
+	for _, r := range ladder {
+		if r.Height <= 0 {
+			return nil, fmt.Errorf("invalid rendition height %d", r.Height)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("%dp", r.Height)
+		}
+		if strings.ContainsAny(r.Name, " ,:/") {
+			return nil, fmt.Errorf("invalid rendition name %q", r.Name)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate rendition name %q", r.Name)
+		}
+		names[r.Name] = true
+
+		if r.AudioBitrate == "" {
+			r.AudioBitrate = "128k"
+		}
+		if r.Profile == "" {
+			r.Profile = "baseline"
+		}
+		if r.Level == "" {
+			r.Level = "3.0"
+		}
+		renditions = append(renditions, r)
+	}
+
+	return renditions, nil
+}
+
+// fitRenditions returns the renditions which are no taller than the source, so that we never
+// upscale. If every rendition is taller than the source, the shortest one is kept, scaled down
+// to the height of the source, rounded down to an even number since libx264 needs one.
+func fitRenditions(renditions []Rendition, sourceHeight int) []Rendition {
+	if sourceHeight <= 0 {
+		return renditions
+	}
+
+	var fitted []Rendition
+	shortest := 0
+	for i, r := range renditions {
+		if r.Height <= sourceHeight {
+			fitted = append(fitted, r)
+		}
+		if r.Height < renditions[shortest].Height {
+			shortest = i
+		}
+	}
+
+	if len(fitted) == 0 {
+		r := renditions[shortest]
+		height := max(sourceHeight&^1, 2)
+		if r.Name == fmt.Sprintf("%dp", r.Height) {
+			r.Name = fmt.Sprintf("%dp", height)
+		}
+		r.Height = height
+		fitted = append(fitted, r)
+	}
+
+	return fitted
+}
+
+// videoArgs returns the ffmpeg arguments which scale and rate control output video
+// stream i to rendition r.
+func (r Rendition) videoArgs(i int) []string {
+	n := strconv.Itoa(i)
+	args := []string{
+		"-filter:v:" + n, fmt.Sprintf("scale=-2:%d", r.Height),
+		"-profile:v:" + n, r.Profile,
+		"-level:v:" + n, r.Level,
+	}
+	if r.VideoBitrate != "" {
+		args = append(args, "-b:v:"+n, r.VideoBitrate)
+	}
+	if r.MaxRate != "" {
+		args = append(args, "-maxrate:v:"+n, r.MaxRate)
+	}
+	if r.BufSize != "" {
+		args = append(args, "-bufsize:v:"+n, r.BufSize)
+	}
+
+	return args
+}
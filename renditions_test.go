@@ -0,0 +1,220 @@
+package streamer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVideo_renditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		ops       *VideoOptions
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "default ladder", ops: nil, wantNames: []string{"1080p", "720p", "480p"}},
+		{name: "custom ladder", ops: &VideoOptions{Renditions: []Rendition{{Height: 1440}, {Height: 360, Name: "mobile"}, {Height: 240}}}, wantNames: []string{"1440p", "mobile", "240p"}},
+		{name: "invalid height", ops: &VideoOptions{Renditions: []Rendition{{Height: 0}}}, wantErr: true},
+		{name: "invalid name", ops: &VideoOptions{Renditions: []Rendition{{Height: 360, Name: "low res"}}}, wantErr: true},
+		{name: "duplicate name", ops: &VideoOptions{Renditions: []Rendition{{Height: 360}, {Height: 360}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wp := New(make(chan VideoProcessingJob), 1)
+			v := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "hls", testNotifyChan, tt.ops)
+
+			renditions, err := v.renditions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error to be %t but got %v", tt.wantErr, err)
+			}
+
+			var names []string
+			for _, r := range renditions {
+				names = append(names, r.Name)
+				if r.AudioBitrate == "" || r.Profile == "" || r.Level == "" {
+					t.Errorf("expected defaults to be filled in but got %+v", r)
+				}
+			}
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("expected renditions %v but got %v", tt.wantNames, names)
+			}
+		})
+	}
+}
+
+func Test_hlsArgs(t *testing.T) {
+	wp := New(make(chan VideoProcessingJob), 1)
+	ops := &VideoOptions{
+		Renditions: []Rendition{
+			{Height: 2160, VideoBitrate: "12000k", MaxRate: "14000k", BufSize: "24000k", AudioBitrate: "192k", Profile: "high", Level: "5.1"},
+			{Height: 360},
+		},
+	}
+	v := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "hls", testNotifyChan, ops)
+
+	renditions, err := v.renditions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := strings.Join(hlsArgs(&v, "b", encodePlan{renditions: renditions}), " ")
+
+	for _, want := range []string{
+		"-map 0:v:0 -map 0:a:0 -map 0:v:0 -map 0:a:0 -c:v",
+		"-filter:v:0 scale=-2:2160 -profile:v:0 high -level:v:0 5.1 -b:v:0 12000k -maxrate:v:0 14000k -bufsize:v:0 24000k -b:a:0 192k",
+		"-filter:v:1 scale=-2:360 -profile:v:1 baseline -level:v:1 3.0 -b:a:1 128k",
+		"-var_stream_map v:0,a:0,name:2160p v:1,a:1,name:360p",
+	} {
+		if !strings.Contains(cmd, want) {
+			t.Errorf("expected command to contain %q but got %q", want, cmd)
+		}
+	}
+
+	if strings.Count(cmd, "-map ") != 4 {
+		t.Errorf("expected 4 maps but got %q", cmd)
+	}
+}
+
+func Test_fitRenditions(t *testing.T) {
+	ladder := []Rendition{{Name: "1080p", Height: 1080}, {Name: "720p", Height: 720}, {Name: "480p", Height: 480}}
+
+	tests := []struct {
+		name         string
+		sourceHeight int
+		wantNames    []string
+		wantHeights  []int
+	}{
+		{name: "1080p source", sourceHeight: 1080, wantNames: []string{"1080p", "720p", "480p"}, wantHeights: []int{1080, 720, 480}},
+		{name: "720p source", sourceHeight: 720, wantNames: []string{"720p", "480p"}, wantHeights: []int{720, 480}},
+		{name: "540p source", sourceHeight: 540, wantNames: []string{"480p"}, wantHeights: []int{480}},
+		{name: "240p source", sourceHeight: 240, wantNames: []string{"240p"}, wantHeights: []int{240}},
+		{name: "odd source", sourceHeight: 241, wantNames: []string{"240p"}, wantHeights: []int{240}},
+		{name: "one line source", sourceHeight: 1, wantNames: []string{"2p"}, wantHeights: []int{2}},
+		{name: "unknown source", sourceHeight: 0, wantNames: []string{"1080p", "720p", "480p"}, wantHeights: []int{1080, 720, 480}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			var heights []int
+			for _, r := range fitRenditions(ladder, tt.sourceHeight) {
+				names = append(names, r.Name)
+				heights = append(heights, r.Height)
+			}
+
+			if !slices.Equal(names, tt.wantNames) || !slices.Equal(heights, tt.wantHeights) {
+				t.Errorf("expected %v %v but got %v %v", tt.wantNames, tt.wantHeights, names, heights)
+			}
+		})
+	}
+}
+
+func Test_audioSource(t *testing.T) {
+	wp := New(make(chan VideoProcessingJob), 1)
+	v := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "hls", testNotifyChan, nil)
+	renditions, err := v.renditions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		audio    audioSource
+		wantHLS  []string
+		wantDASH []string
+		notWant  []string
+	}{
+		{
+			name:     "from input",
+			audio:    audioFromInput,
+			wantHLS:  []string{"-map 0:v:0 -map 0:a:0", "-var_stream_map v:0,a:0,name:1080p v:1,a:1,name:720p v:2,a:2,name:480p"},
+			wantDASH: []string{"-map 0:a:0 -c:a aac", "-adaptation_sets id=0,streams=v id=1,streams=a"},
+			notWant:  []string{"anullsrc", "-shortest"},
+		},
+		{
+			name:     "silent",
+			audio:    audioSilent,
+			wantHLS:  []string{"-f lavfi -i anullsrc", "-map 0:v:0 -map 1:a:0", "-shortest", "v:0,a:0,name:1080p"},
+			wantDASH: []string{"-f lavfi -i anullsrc", "-map 1:a:0", "-shortest", "-adaptation_sets id=0,streams=v id=1,streams=a"},
+			notWant:  []string{"0:a:0"},
+		},
+		{
+			name:     "none",
+			audio:    audioNone,
+			wantHLS:  []string{"-var_stream_map v:0,name:1080p v:1,name:720p v:2,name:480p"},
+			wantDASH: []string{"-adaptation_sets id=0,streams=v -init_seg_name"},
+			notWant:  []string{":a:", "-c:a", "-b:a", "anullsrc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := encodePlan{renditions: renditions, audio: tt.audio}
+			hls := strings.Join(hlsArgs(&v, "b", plan), " ")
+			dash := strings.Join(dashArgs(&v, v.OutputDir, "b", plan), " ")
+
+			for _, want := range tt.wantHLS {
+				if !strings.Contains(hls, want) {
+					t.Errorf("expected HLS command to contain %q but got %q", want, hls)
+				}
+			}
+			for _, want := range tt.wantDASH {
+				if !strings.Contains(dash, want) {
+					t.Errorf("expected DASH command to contain %q but got %q", want, dash)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(hls, notWant) || strings.Contains(dash, notWant) {
+					t.Errorf("expected commands not to contain %q but got %q and %q", notWant, hls, dash)
+				}
+			}
+		})
+	}
+}
+
+func Test_moveCMAF(t *testing.T) {
+	dir := t.TempDir()
+	workDir := filepath.Join(dir, "b-cmaf.tmp")
+	if err := os.Mkdir(workDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	master := "#EXTM3U\n#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"group_A1\",NAME=\"audio_0\",URI=\"media_1.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1405600,RESOLUTION=1280x720,AUDIO=\"group_A1\"\nmedia_0.m3u8\n"
+	files := map[string]string{
+		"b.m3u8":              master,
+		"b.mpd":               "<MPD/>",
+		"media_0.m3u8":        "#EXTM3U\n",
+		"media_1.m3u8":        "#EXTM3U\n",
+		"b-chunk-0-00001.m4s": "",
+		"b-init-0.m4s":        "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := moveCMAF(workDir, dir, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"b.m3u8", "b.mpd", "b-media-0.m3u8", "b-media-1.m3u8", "b-chunk-0-00001.m4s", "b-init-0.m4s"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be moved but got %v", name, err)
+		}
+	}
+	if entries, _ := os.ReadDir(workDir); len(entries) != 0 {
+		t.Errorf("expected nothing to be left behind but got %v", entries)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, "b.m3u8"))
+	want := "#EXTM3U\n#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"group_A1\",NAME=\"audio_0\",URI=\"b-media-1.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1405600,RESOLUTION=1280x720,AUDIO=\"group_A1\"\nb-media-0.m3u8\n"
+	if string(got) != want {
+		t.Errorf("expected master playlist\n%s\nbut got\n%s", want, got)
+	}
+}
@@ -0,0 +1,60 @@
+package streamer
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy says whether, and how often, a failed encode is retried by the dispatcher.
+// Between attempts the dispatcher waits for a backoff which starts at InitialBackoff and is
+// multiplied by Multiplier after every attempt, up to MaxBackoff, and then reduced by a random
+// fraction of up to Jitter, so that jobs which failed together don't all retry together.
+// While an encode is waiting to be retried, no message is sent to its NotifyChan.
+type RetryPolicy struct {
+	MaxAttempts    int              // The most times to try an encode, including the first. Less than 2 means no retries.
+	InitialBackoff time.Duration    // How long to wait before the first retry. Defaults to one second.
+	MaxBackoff     time.Duration    // The longest to wait between attempts. Zero means no limit.
+	Multiplier     float64          // How much the backoff grows after each attempt. Defaults to 2.
+	Jitter         float64          // The largest fraction of the backoff to take off at random, from 0 to 1.
+	Retryable      func(error) bool // Which errors are worth retrying. Defaults to IsTransient.
+}
+
+// shouldRetry returns true if an encode which has been attempted attempts times, and
+// failed with err, should be tried again.
+func (p *RetryPolicy) shouldRetry(attempts int, err error) bool {
+	if p == nil || err == nil || attempts >= p.MaxAttempts {
+		return false
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// backoff returns how long to wait before trying an encode again, after it has been
+// attempted attempts times.
+func (p *RetryPolicy) backoff(attempts int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	d := float64(initial) * math.Pow(multiplier, float64(attempts-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if d > math.MaxInt64 {
+		d = math.MaxInt64
+	}
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		d -= d * jitter * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
@@ -0,0 +1,108 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 100: 5 * time.Second} {
+		if got := p.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(2); got < time.Second || got > 2*time.Second {
+			t.Fatalf("expected backoff with jitter to be between 1s and 2s but got %s", got)
+		}
+	}
+
+	if got := (&RetryPolicy{}).backoff(1); got != time.Second {
+		t.Errorf("expected a default backoff of 1s but got %s", got)
+	}
+}
+
+func TestRetryPolicy_shouldRetry(t *testing.T) {
+	var nilPolicy *RetryPolicy
+	if nilPolicy.shouldRetry(1, ErrKilled) {
+		t.Error("expected no retries without a policy")
+	}
+
+	p := &RetryPolicy{MaxAttempts: 3}
+	tests := []struct {
+		attempts int
+		err      error
+		want     bool
+	}{
+		{attempts: 1, err: ErrKilled, want: true},
+		{attempts: 2, err: ErrDiskFull, want: true},
+		{attempts: 3, err: ErrKilled, want: false},
+		{attempts: 1, err: ErrInvalidInput, want: false},
+		{attempts: 1, err: errors.New("some error"), want: false},
+		{attempts: 1, err: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := p.shouldRetry(tt.attempts, tt.err); got != tt.want {
+			t.Errorf("shouldRetry(%d, %v) = %t, want %t", tt.attempts, tt.err, got, tt.want)
+		}
+	}
+
+	p.Retryable = func(err error) bool { return true }
+	if !p.shouldRetry(1, errors.New("some error")) {
+		t.Error("expected a custom Retryable to be used")
+	}
+}
+
+func TestVideoDispatcher_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		err          error
+		wantSuccess  bool
+		wantAttempts int
+	}{
+		{name: "succeeds on retry", failures: 2, err: ErrKilled, wantSuccess: true, wantAttempts: 3},
+		{name: "runs out of attempts", failures: 5, err: ErrKilled, wantSuccess: false, wantAttempts: 3},
+		{name: "permanent failure", failures: 5, err: ErrInvalidInput, wantSuccess: false, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			engine := testEncoderFunc{fn: func(v *Video) error {
+				if calls.Add(1) <= tt.failures {
+					return tt.err
+				}
+				return nil
+			}}
+
+			videoQueue := make(chan VideoProcessingJob)
+			wp := New(videoQueue, 1, Processor{Engine: &engine})
+			wp.Retry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+			wp.Run()
+			defer wp.Shutdown(context.Background())
+
+			notifyChan := make(chan ProcessingMessage, 10)
+			v := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)
+			videoQueue <- VideoProcessingJob{Video: v}
+
+			result := <-notifyChan
+			if result.Successful != tt.wantSuccess || result.Attempts != tt.wantAttempts {
+				t.Errorf("expected success %t after %d attempts but got %+v", tt.wantSuccess, tt.wantAttempts, result)
+			}
+			if !tt.wantSuccess && !errors.Is(result.Err, tt.err) {
+				t.Errorf("expected error %v but got %v", tt.err, result.Err)
+			}
+			if len(notifyChan) != 0 {
+				t.Errorf("expected one message but got %d more", len(notifyChan))
+			}
+		})
+	}
+}
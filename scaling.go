@@ -0,0 +1,163 @@
+package streamer
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resize changes the number of workers to n, or one if n is less than one. New workers start
+// straight away. Workers are retired as they become free, so no encode is interrupted and no
+// job is lost. Called before Run, Resize just changes how many workers Run starts.
+func (vd *VideoDispatcher) Resize(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	vd.mu.Lock()
+	defer vd.mu.Unlock()
+
+	delta := n - vd.maxWorkers
+	vd.maxWorkers = n
+	if !vd.running || delta == 0 {
+		return
+	}
+
+	select {
+	case <-vd.quit:
+		return
+	default:
+	}
+
+	if delta < 0 {
+		vd.retiring -= delta
+
+		// Wake the dispatcher, so that it retires a worker as soon as one is free.
+		select {
+		case vd.wake <- struct{}{}:
+		default:
+		}
+		return
+	}
+
+	// Workers which are still to be retired can simply be kept.
+	kept := min(delta, vd.retiring)
+	vd.retiring -= kept
+	for i := kept; i < delta; i++ {
+		vd.startWorker()
+	}
+}
+
+// startWorker starts a new worker. It must be called with vd.mu held.
+func (vd *VideoDispatcher) startWorker() {
+	vd.lastWorkerID++
+	worker := newVideoWorker(vd.lastWorkerID, vd)
+	vd.wg.Add(1)
+	worker.start()
+}
+
+// AutoscalePolicy says how the dispatcher changes its number of workers to suit the load.
+// Every interval, a worker is added for each job waiting for one, unless the host is already
+// busy enough; a worker is retired if some are idle and no jobs are waiting, or if the host is
+// too busy.
+type AutoscalePolicy struct {
+	MinWorkers int                     // The fewest workers to scale down to. If below one, one.
+	MaxWorkers int                     // The most workers to scale up to. If zero, the number of CPUs.
+	Interval   time.Duration           // How often to check the load. If zero, 30 seconds.
+	MaxLoad    float64                 // If above zero, the load per CPU above which workers are retired, and at which none are added.
+	Load       func() (float64, error) // Returns the load per CPU of the host. If nil, the one minute load average from /proc/loadavg is used.
+}
+
+// workers returns how many workers there should be, given stats and the load per CPU of the host.
+func (p *AutoscalePolicy) workers(stats DispatcherStats, load float64) int {
+	n := stats.Workers
+	switch {
+	case p.MaxLoad > 0 && load > p.MaxLoad:
+		// The host is overloaded.
+		n--
+	case stats.Pending > 0 && (p.MaxLoad <= 0 || load < p.MaxLoad):
+		n += stats.Pending
+	case stats.Pending == 0 && stats.BusyWorkers < stats.Workers:
+		// Some workers have nothing to do.
+		n--
+	}
+
+	maxWorkers := p.MaxWorkers
+	if maxWorkers <= 0 {
+		maxWorkers = runtime.NumCPU()
+	}
+	return max(min(n, maxWorkers), p.MinWorkers, 1)
+}
+
+// load returns the load per CPU of the host, using p.Load if it is set.
+func (p *AutoscalePolicy) load() (float64, error) {
+	if p.Load != nil {
+		return p.Load()
+	}
+	return loadAverage()
+}
+
+// loadAverage returns the one minute load average of the host, divided by the number of CPUs.
+// It only works on Linux.
+func loadAverage() (float64, error) {
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return 0, errors.New("empty /proc/loadavg")
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return load / float64(runtime.NumCPU()), nil
+}
+
+// autoscale resizes the dispatcher according to p until the dispatcher is shut down.
+func (vd *VideoDispatcher) autoscale(p *AutoscalePolicy) {
+	defer vd.wg.Done()
+
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-vd.quit:
+			return
+		}
+
+		// If the load can't be read, scale on the queue alone.
+		load, err := p.load()
+		if err != nil {
+			load = 0
+		}
+
+		// While paused, the backlog says nothing about how many workers are needed.
+		stats := vd.Stats()
+		if stats.Paused {
+			continue
+		}
+		if n := p.workers(stats, load); n != stats.Workers {
+			vd.logger().Info("resizing worker pool",
+				slog.Int("from", stats.Workers),
+				slog.Int("to", n),
+				slog.Int("pending", stats.Pending),
+				slog.Float64("load", load),
+			)
+			vd.Resize(n)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package streamer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestVideoDispatcher_Resize(t *testing.T) {
+	engine := testEncoderBlocking{started: make(chan int)}
+	wp := New(nil, 1, Processor{Engine: &engine})
+	wp.Run()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		wp.Shutdown(ctx)
+	}()
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	submit := func(id int) {
+		_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(id, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+	}
+
+	// With three workers, three videos run at once.
+	wp.Resize(3)
+	for id := 1; id <= 3; id++ {
+		submit(id)
+	}
+	for id := 1; id <= 3; id++ {
+		<-engine.started
+	}
+
+	// Shrinking the pool interrupts nothing.
+	wp.Resize(1)
+	if n := wp.Stats().Workers; n != 1 {
+		t.Errorf("expected 1 worker but got %d", n)
+	}
+	select {
+	case result := <-notifyChan:
+		t.Fatalf("expected the running videos to carry on but got %+v", result)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Once they are done, only one worker is left.
+	for id := 1; id <= 3; id++ {
+		wp.Cancel(id)
+		<-notifyChan
+	}
+	submit(4)
+	submit(5)
+	<-engine.started
+	select {
+	case id := <-engine.started:
+		t.Errorf("expected only one video to start but video %d did too", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := wp.Stats().Pending; n != 1 {
+		t.Errorf("expected 1 video to be waiting but got %d", n)
+	}
+}
+
+func TestAutoscalePolicy_workers(t *testing.T) {
+	policy := AutoscalePolicy{MinWorkers: 2, MaxWorkers: 8, MaxLoad: 0.8}
+
+	tests := []struct {
+		name  string
+		stats DispatcherStats
+		load  float64
+		want  int
+	}{
+		{name: "steady", stats: DispatcherStats{Workers: 4, BusyWorkers: 4}, load: 0.5, want: 4},
+		{name: "backlog", stats: DispatcherStats{Workers: 4, BusyWorkers: 4, Pending: 3}, load: 0.5, want: 7},
+		{name: "backlog over max", stats: DispatcherStats{Workers: 4, BusyWorkers: 4, Pending: 10}, load: 0.5, want: 8},
+		{name: "backlog at max load", stats: DispatcherStats{Workers: 4, BusyWorkers: 4, Pending: 3}, load: 0.8, want: 4},
+		{name: "overloaded", stats: DispatcherStats{Workers: 4, BusyWorkers: 4, Pending: 3}, load: 1.5, want: 3},
+		{name: "idle", stats: DispatcherStats{Workers: 4, BusyWorkers: 1}, load: 0.1, want: 3},
+		{name: "idle at min", stats: DispatcherStats{Workers: 2}, load: 0.1, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.workers(tt.stats, tt.load); got != tt.want {
+				t.Errorf("expected %d workers but got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestVideoDispatcher_Autoscale(t *testing.T) {
+	engine := testEncoderBlocking{started: make(chan int)}
+	wp := New(nil, 1, Processor{Engine: &engine})
+	wp.Autoscale = &AutoscalePolicy{
+		MaxWorkers: 3,
+		Interval:   5 * time.Millisecond,
+		Load:       func() (float64, error) { return 0, nil },
+	}
+	wp.Run()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		wp.Shutdown(ctx)
+	}()
+
+	// A backlog makes the pool grow until every video is running.
+	notifyChan := make(chan ProcessingMessage, 10)
+	for id := 1; id <= 3; id++ {
+		_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(id, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+	}
+	for id := 1; id <= 3; id++ {
+		select {
+		case <-engine.started:
+		case <-time.After(time.Second):
+			t.Fatalf("expected 3 videos to start, but only %d did", id-1)
+		}
+	}
+	if n := wp.Stats().Workers; n != 3 {
+		t.Errorf("expected 3 workers but got %d", n)
+	}
+}
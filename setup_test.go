@@ -1,6 +1,7 @@
 package streamer
 
 import (
+	"context"
 	"errors"
 	"os"
 	"testing"
@@ -48,6 +49,31 @@ func (te *testEncoder) EncodeToHLSEncrypted(v *Video, baseFileName string) error
 	return nil
 }
 
+// EncodeToDASH takes a Video object and a base file name, and simulates encoding to MPEG-DASH format successfully.
+func (te *testEncoder) EncodeToDASH(v *Video, baseFileName string) error {
+	return nil
+}
+
+// EncodeToCMAF takes a Video object and a base file name, and simulates encoding to CMAF format successfully.
+func (te *testEncoder) EncodeToCMAF(v *Video, baseFileName string) error {
+	return nil
+}
+
+// EncodeToPreview takes a Video object and a base file name, and simulates making a preview successfully.
+func (te *testEncoder) EncodeToPreview(v *Video, baseFileName string) error {
+	return nil
+}
+
+// EncodeThumbnails takes a Video object and a base file name, and simulates taking images successfully.
+func (te *testEncoder) EncodeThumbnails(v *Video, baseFileName string) error {
+	return nil
+}
+
+// EncodeSprites takes a Video object and a base file name, and simulates making sprites successfully.
+func (te *testEncoder) EncodeSprites(v *Video, baseFileName string) error {
+	return nil
+}
+
 // testEncoderFailing is a type which satisfies the Encoder interface. We use it to
 // test for encodes which fail, so all its methods return an error.
 type testEncoderFailing struct{}
@@ -67,3 +93,133 @@ func (tef *testEncoderFailing) EncodeToHLS(v *Video, baseFileName string) error
 func (tef *testEncoderFailing) EncodeToHLSEncrypted(v *Video, baseFileName string) error {
 	return errors.New("some error")
 }
+
+// EncodeToDASH takes a Video object and a base file name, and simulates encoding to MPEG-DASH format
+// unsuccessfully.
+func (tef *testEncoderFailing) EncodeToDASH(v *Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+// EncodeToCMAF takes a Video object and a base file name, and simulates encoding to CMAF format
+// unsuccessfully.
+func (tef *testEncoderFailing) EncodeToCMAF(v *Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+// EncodeToPreview takes a Video object and a base file name, and simulates making a preview unsuccessfully.
+func (tef *testEncoderFailing) EncodeToPreview(v *Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+// EncodeThumbnails takes a Video object and a base file name, and simulates taking images unsuccessfully.
+func (tef *testEncoderFailing) EncodeThumbnails(v *Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+// EncodeSprites takes a Video object and a base file name, and simulates making sprites unsuccessfully.
+func (tef *testEncoderFailing) EncodeSprites(v *Video, baseFileName string) error {
+	return errors.New("some error")
+}
+
+// testEncoderBlocking is a type which satisfies the Encoder interface. Each of its methods
+// signals on started, and then blocks until the context of the video is done, returning the
+// cause. We use it to test jobs which are still running when they are cancelled.
+type testEncoderBlocking struct {
+	started chan int
+}
+
+// wait signals that the encode of v has started, and blocks until its context is done.
+func (teb *testEncoderBlocking) wait(v *Video) error {
+	if teb.started != nil {
+		teb.started <- v.ID
+	}
+	<-v.Context().Done()
+	return context.Cause(v.Context())
+}
+
+// EncodeToMP4 takes a Video object and a base file name, and blocks until the encode is cancelled.
+func (teb *testEncoderBlocking) EncodeToMP4(v *Video, baseFileName string) error {
+	return teb.wait(v)
+}
+
+// EncodeToHLS takes a Video object and a base file name, and blocks until the encode is cancelled.
+func (teb *testEncoderBlocking) EncodeToHLS(v *Video, baseFileName string) error {
+	return teb.wait(v)
+}
+
+// EncodeToHLSEncrypted takes a Video object and a base file name, and blocks until the encode is cancelled.
+func (teb *testEncoderBlocking) EncodeToHLSEncrypted(v *Video, baseFileName string) error {
+	return teb.wait(v)
+}
+
+// EncodeToDASH takes a Video object and a base file name, and blocks until the encode is cancelled.
+func (teb *testEncoderBlocking) EncodeToDASH(v *Video, baseFileName string) error {
+	return teb.wait(v)
+}
+
+// EncodeToCMAF takes a Video object and a base file name, and blocks until the encode is cancelled.
+func (teb *testEncoderBlocking) EncodeToCMAF(v *Video, baseFileName string) error {
+	return teb.wait(v)
+}
+
+// EncodeToPreview takes a Video object and a base file name, and blocks until the encode is cancelled.
+func (teb *testEncoderBlocking) EncodeToPreview(v *Video, baseFileName string) error {
+	return teb.wait(v)
+}
+
+// EncodeThumbnails takes a Video object and a base file name, and blocks until the encode is cancelled.
+func (teb *testEncoderBlocking) EncodeThumbnails(v *Video, baseFileName string) error {
+	return teb.wait(v)
+}
+
+// EncodeSprites takes a Video object and a base file name, and blocks until the encode is cancelled.
+func (teb *testEncoderBlocking) EncodeSprites(v *Video, baseFileName string) error {
+	return teb.wait(v)
+}
+
+// testEncoderFunc is a type which satisfies the Encoder interface by calling fn for
+// every encoding type. We use it for tests which need an encoder to behave differently
+// from one call to the next.
+type testEncoderFunc struct {
+	fn func(v *Video) error
+}
+
+// EncodeToMP4 takes a Video object and a base file name, and returns the result of fn.
+func (tef *testEncoderFunc) EncodeToMP4(v *Video, baseFileName string) error {
+	return tef.fn(v)
+}
+
+// EncodeToHLS takes a Video object and a base file name, and returns the result of fn.
+func (tef *testEncoderFunc) EncodeToHLS(v *Video, baseFileName string) error {
+	return tef.fn(v)
+}
+
+// EncodeToHLSEncrypted takes a Video object and a base file name, and returns the result of fn.
+func (tef *testEncoderFunc) EncodeToHLSEncrypted(v *Video, baseFileName string) error {
+	return tef.fn(v)
+}
+
+// EncodeToDASH takes a Video object and a base file name, and returns the result of fn.
+func (tef *testEncoderFunc) EncodeToDASH(v *Video, baseFileName string) error {
+	return tef.fn(v)
+}
+
+// EncodeToCMAF takes a Video object and a base file name, and returns the result of fn.
+func (tef *testEncoderFunc) EncodeToCMAF(v *Video, baseFileName string) error {
+	return tef.fn(v)
+}
+
+// EncodeToPreview takes a Video object and a base file name, and returns the result of fn.
+func (tef *testEncoderFunc) EncodeToPreview(v *Video, baseFileName string) error {
+	return tef.fn(v)
+}
+
+// EncodeThumbnails takes a Video object and a base file name, and returns the result of fn.
+func (tef *testEncoderFunc) EncodeThumbnails(v *Video, baseFileName string) error {
+	return tef.fn(v)
+}
+
+// EncodeSprites takes a Video object and a base file name, and returns the result of fn.
+func (tef *testEncoderFunc) EncodeSprites(v *Video, baseFileName string) error {
+	return tef.fn(v)
+}
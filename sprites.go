@@ -0,0 +1,187 @@
+package streamer
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// SpriteOptions says how to make the sprite sheets and WebVTT track which players use to show
+// previews when hovering over the seek bar. A frame is taken every interval, scaled to a tile,
+// and the tiles are laid out in rows on as many sheets as it takes. The track maps each interval
+// of the video to its tile, e.g. "name-sprite-001.jpg#xywh=160,0,160,90".
+type SpriteOptions struct {
+	Interval time.Duration // How often to take a frame. If zero, every 10 seconds.
+	Width    int           // The width of each tile in pixels. If zero, 160.
+	Height   int           // The height of each tile in pixels. If zero, the width is scaled to keep the aspect ratio.
+	Columns  int           // How many tiles there are in each row of a sheet. If zero, 10.
+	Rows     int           // How many rows there are on each sheet. If zero, 10.
+	Format   string        // The format of the sheets: "jpg" or "webp". If empty, "jpg".
+}
+
+// interval returns how often a frame is taken, with the default filled in.
+func (o *SpriteOptions) interval() time.Duration {
+	if o.Interval == 0 {
+		return 10 * time.Second
+	}
+	return o.Interval
+}
+
+// width returns the width of each tile, with the default filled in.
+func (o *SpriteOptions) width() int {
+	if o.Width == 0 {
+		return 160
+	}
+	return o.Width
+}
+
+// columns returns how many tiles there are in each row, with the default filled in.
+func (o *SpriteOptions) columns() int {
+	if o.Columns == 0 {
+		return 10
+	}
+	return o.Columns
+}
+
+// rows returns how many rows there are on each sheet, with the default filled in.
+func (o *SpriteOptions) rows() int {
+	if o.Rows == 0 {
+		return 10
+	}
+	return o.Rows
+}
+
+// format returns the format of the sheets, with the default filled in.
+func (o *SpriteOptions) format() string {
+	if o.Format == "" {
+		return "jpg"
+	}
+	return o.Format
+}
+
+// validate returns an error matching ErrInvalidInput if o can't be used.
+func (o *SpriteOptions) validate() error {
+	switch {
+	case o.format() != "jpg" && o.format() != "webp":
+		return fmt.Errorf("%w: invalid sprite format %q", ErrInvalidInput, o.Format)
+	case o.interval() < 0:
+		return fmt.Errorf("%w: invalid sprite interval %s", ErrInvalidInput, o.Interval)
+	case o.width() < 0 || o.Height < 0:
+		return fmt.Errorf("%w: invalid sprite size %dx%d", ErrInvalidInput, o.Width, o.Height)
+	case o.columns() < 0 || o.rows() < 0:
+		return fmt.Errorf("%w: invalid sprite grid %dx%d", ErrInvalidInput, o.Columns, o.Rows)
+	}
+	return nil
+}
+
+// tileHeight returns the height of each tile for a video with the given display size. Unless
+// it is set, it is scaled from the width to keep the aspect ratio, rounded to an even number.
+func (o *SpriteOptions) tileHeight(width, height int) int {
+	if o.Height > 0 {
+		return o.Height
+	}
+	h := int(math.Round(float64(o.width()*height)/float64(width)/2)) * 2
+	return max(h, 2)
+}
+
+// sheetPattern returns the pattern of the file names of the sheets, as used by the image muxer
+// of ffmpeg, which numbers them from one.
+func (o *SpriteOptions) sheetPattern(baseFileName string) string {
+	return fmt.Sprintf("%s-sprite-%%03d.%s", baseFileName, o.format())
+}
+
+// sheetName returns the file name of the sheet with the given number, counting from one.
+func (o *SpriteOptions) sheetName(baseFileName string, n int) string {
+	return fmt.Sprintf(o.sheetPattern(baseFileName), n)
+}
+
+// trackName returns the file name of the WebVTT track for the output with the given base file name.
+func (o *SpriteOptions) trackName(baseFileName string) string {
+	return fmt.Sprintf("%s-sprites.vtt", baseFileName)
+}
+
+// spriteArgs returns the arguments for ffmpeg to make the sprite sheets of v, with tiles of the
+// given height.
+func spriteArgs(v *Video, baseFileName string, o *SpriteOptions, tileHeight int) []string {
+	filter := fmt.Sprintf("fps=1/%s,scale=%d:%d,tile=%dx%d",
+		seconds(o.interval()), o.width(), tileHeight, o.columns(), o.rows())
+
+	args := []string{
+		"-y",
+		"-i", v.InputFile,
+		"-map", "0:v:0",
+		"-vf", filter,
+	}
+	args = append(args, imageArgs(o.format())...)
+
+	return append(args, fmt.Sprintf("%s/%s", v.OutputDir, o.sheetPattern(baseFileName)))
+}
+
+// spriteTrack returns the WebVTT track for a video of the given duration, with tiles of the
+// given height, along with the names of the sheets it refers to.
+func spriteTrack(baseFileName string, o *SpriteOptions, duration time.Duration, tileHeight int) (string, []string) {
+	perSheet := o.columns() * o.rows()
+	interval := o.interval()
+
+	var b strings.Builder
+	var sheets []string
+	b.WriteString("WEBVTT\n")
+	for i := 0; time.Duration(i)*interval < duration; i++ {
+		sheet, tile := i/perSheet, i%perSheet
+		if tile == 0 {
+			sheets = append(sheets, o.sheetName(baseFileName, sheet+1))
+		}
+
+		start := time.Duration(i) * interval
+		end := min(start+interval, duration)
+		x, y := (tile%o.columns())*o.width(), (tile/o.columns())*tileHeight
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), sheets[sheet], x, y, o.width(), tileHeight)
+	}
+
+	return b.String(), sheets
+}
+
+// vttTimestamp formats d as a WebVTT timestamp, e.g. 01:02:03.450.
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// EncodeSprites takes a Video object and the base file name of its output, and makes the sprite
+// sheets and WebVTT track asked for in v.Options.Sprites. The names of the sheets are recorded in
+// v, so that they can be reported back to the client.
+// The ffmpeg process is killed if the context of v is cancelled.
+func (ve *VideoEncoder) EncodeSprites(v *Video, baseFileName string) error {
+	o := v.Options.Sprites
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	info, err := Probe(v.Context(), v.InputFile)
+	if err != nil {
+		return err
+	}
+	stream := info.VideoStream()
+	if stream == nil || stream.DisplayWidth() <= 0 {
+		return fmt.Errorf("%s: %w: %w", v.InputFile, ErrInvalidInput, ErrNoVideoStream)
+	}
+	if info.Duration <= 0 {
+		return fmt.Errorf("%w: the duration of the input is unknown", ErrInvalidInput)
+	}
+	tileHeight := o.tileHeight(stream.DisplayWidth(), stream.DisplayHeight())
+
+	if err := ve.runFFmpeg(v, spriteArgs(v, baseFileName, o, tileHeight)...); err != nil {
+		return err
+	}
+
+	track, sheets := spriteTrack(baseFileName, o, info.Duration, tileHeight)
+	if err := os.WriteFile(fmt.Sprintf("%s/%s", v.OutputDir, o.trackName(baseFileName)), []byte(track), 0644); err != nil {
+		return classify(v.Context(), err, nil)
+	}
+	v.spriteSheets = sheets
+
+	return nil
+}
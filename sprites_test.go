@@ -0,0 +1,120 @@
+package streamer
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpriteOptions_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     SpriteOptions
+		wantErr bool
+	}{
+		{name: "defaults", ops: SpriteOptions{}},
+		{name: "webp", ops: SpriteOptions{Format: "webp", Interval: 2 * time.Second, Width: 120, Columns: 5, Rows: 4}},
+		{name: "bad format", ops: SpriteOptions{Format: "gif"}, wantErr: true},
+		{name: "negative interval", ops: SpriteOptions{Interval: -time.Second}, wantErr: true},
+		{name: "negative height", ops: SpriteOptions{Height: -90}, wantErr: true},
+		{name: "negative columns", ops: SpriteOptions{Columns: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ops.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %t but got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("expected %v to be ErrInvalidInput", err)
+			}
+		})
+	}
+}
+
+func TestSpriteOptions_tileHeight(t *testing.T) {
+	tests := []struct {
+		name          string
+		ops           SpriteOptions
+		width, height int
+		want          int
+	}{
+		{name: "16:9", ops: SpriteOptions{}, width: 1920, height: 1080, want: 90},
+		{name: "4:3", ops: SpriteOptions{Width: 200}, width: 640, height: 480, want: 150},
+		{name: "rounded to even", ops: SpriteOptions{Width: 100}, width: 1920, height: 1080, want: 56},
+		{name: "set", ops: SpriteOptions{Height: 100}, width: 1920, height: 1080, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ops.tileHeight(tt.width, tt.height); got != tt.want {
+				t.Errorf("expected %d but got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_spriteArgs(t *testing.T) {
+	v := Video{InputFile: "./a/b.mp4", OutputDir: "./testdata/output"}
+
+	cmd := strings.Join(spriteArgs(&v, "b", &SpriteOptions{Interval: 5 * time.Second, Columns: 4, Rows: 3}, 90), " ")
+	want := "-y -i ./a/b.mp4 -map 0:v:0 -vf fps=1/5.000,scale=160:90,tile=4x3 -q:v 2 ./testdata/output/b-sprite-%03d.jpg"
+	if cmd != want {
+		t.Errorf("expected %q but got %q", want, cmd)
+	}
+}
+
+func Test_spriteTrack(t *testing.T) {
+	ops := &SpriteOptions{Interval: 10 * time.Second, Width: 100, Columns: 2, Rows: 2}
+
+	track, sheets := spriteTrack("b", ops, 45*time.Second, 56)
+
+	want := `WEBVTT
+
+00:00:00.000 --> 00:00:10.000
+b-sprite-001.jpg#xywh=0,0,100,56
+
+00:00:10.000 --> 00:00:20.000
+b-sprite-001.jpg#xywh=100,0,100,56
+
+00:00:20.000 --> 00:00:30.000
+b-sprite-001.jpg#xywh=0,56,100,56
+
+00:00:30.000 --> 00:00:40.000
+b-sprite-001.jpg#xywh=100,56,100,56
+
+00:00:40.000 --> 00:00:45.000
+b-sprite-002.jpg#xywh=0,0,100,56
+`
+	if track != want {
+		t.Errorf("expected track\n%s\nbut got\n%s", want, track)
+	}
+	if !slices.Equal(sheets, []string{"b-sprite-001.jpg", "b-sprite-002.jpg"}) {
+		t.Errorf("unexpected sheets %v", sheets)
+	}
+}
+
+func Test_vttTimestamp(t *testing.T) {
+	if got := vttTimestamp(time.Hour + 2*time.Minute + 3450*time.Millisecond); got != "01:02:03.450" {
+		t.Errorf("expected 01:02:03.450 but got %s", got)
+	}
+}
+
+func TestVideo_sprites(t *testing.T) {
+	wp := New(make(chan VideoProcessingJob), 1, testProcessor)
+	ops := &VideoOptions{Sprites: &SpriteOptions{}}
+	v := wp.NewVideo(1, "./testdata/i.mp4", "./testdata/output", "hls", testNotifyChan, ops)
+
+	v.encode()
+
+	result := <-testNotifyChan
+	if !result.Successful {
+		t.Fatalf("expected success but got %+v", result)
+	}
+	if result.SpriteTrack != "i-sprites.vtt" {
+		t.Errorf("expected sprite track i-sprites.vtt but got %q", result.SpriteTrack)
+	}
+}
@@ -0,0 +1,210 @@
+package streamer
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// defaultKeepFinished is how long the status of a finished job is kept, if the dispatcher
+// doesn't say otherwise.
+const defaultKeepFinished = time.Hour
+
+// defaultMaxFinished is how many finished jobs have their status kept, if the dispatcher
+// doesn't say otherwise.
+const defaultMaxFinished = 1000
+
+// JobStatus is what the dispatcher knows about a job it has taken.
+type JobStatus struct {
+	ID           int             `json:"id"`            // The ID of the video.
+	EncodingType string          `json:"encoding_type"` // mp4, hls, hls-encrypted, dash, cmaf, or preview.
+	Priority     int             `json:"priority"`      // The priority of the job.
+	State        JobState        `json:"state"`         // What has happened to the job so far.
+	Worker       int             `json:"worker"`        // The id of the worker running the job, or 0 if it isn't running.
+	Attempts     int             `json:"attempts"`      // How many times the encode has been attempted.
+	Message      string          `json:"message"`       // Why the job failed or was cancelled, if it did.
+	Progress     ProgressMessage `json:"progress"`      // The last progress reported by the current or last attempt.
+	QueuedAt     time.Time       `json:"queued_at"`     // When the dispatcher took the job.
+	StartedAt    time.Time       `json:"started_at"`    // When the current or last attempt started.
+	FinishedAt   time.Time       `json:"finished_at"`   // When the job finished, if it has.
+}
+
+// StatusFilter selects jobs for List. The zero value selects every job.
+type StatusFilter struct {
+	States       []JobState // If not empty, only jobs in one of these states.
+	EncodingType string     // If not empty, only jobs with this encoding type.
+}
+
+// matches returns true if s is selected by f.
+func (f StatusFilter) matches(s JobStatus) bool {
+	if len(f.States) > 0 && !slices.Contains(f.States, s.State) {
+		return false
+	}
+	return f.EncodingType == "" || f.EncodingType == s.EncodingType
+}
+
+// DispatcherStats is a snapshot of how busy the dispatcher is.
+type DispatcherStats struct {
+	Workers     int  `json:"workers"`      // The number of workers.
+	BusyWorkers int  `json:"busy_workers"` // How many workers are running an encode.
+	Pending     int  `json:"pending"`      // How many jobs are waiting for a worker.
+	Queued      int  `json:"queued"`       // How many jobs are queued, including those waiting to be retried.
+	Paused      bool `json:"paused"`       // True if the dispatcher is paused.
+}
+
+// Status returns the status of the job for the video with the given id, and false if the
+// dispatcher has not taken a job for that video, has forgotten it, or handed it back from Shutdown.
+func (vd *VideoDispatcher) Status(id int) (JobStatus, bool) {
+	vd.statusMu.Lock()
+	defer vd.statusMu.Unlock()
+
+	s, ok := vd.statuses[id]
+	if !ok {
+		return JobStatus{}, false
+	}
+	return *s, true
+}
+
+// List returns the status of every job selected by filter, ordered by video ID. Finished jobs
+// are kept until they are forgotten with Forget, or are dropped to make room as set by
+// KeepFinished and MaxFinished.
+func (vd *VideoDispatcher) List(filter StatusFilter) []JobStatus {
+	vd.statusMu.Lock()
+	defer vd.statusMu.Unlock()
+
+	var list []JobStatus
+	for _, s := range vd.statuses {
+		if filter.matches(*s) {
+			list = append(list, *s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// Forget removes the status of the finished job for the video with the given id. It returns
+// false if there is no such job, or it has not finished.
+func (vd *VideoDispatcher) Forget(id int) bool {
+	vd.statusMu.Lock()
+	defer vd.statusMu.Unlock()
+
+	s, ok := vd.statuses[id]
+	if !ok || !s.State.Finished() {
+		return false
+	}
+	delete(vd.statuses, id)
+
+	return true
+}
+
+// Stats returns a snapshot of how busy the dispatcher is.
+func (vd *VideoDispatcher) Stats() DispatcherStats {
+	vd.mu.Lock()
+	stats := DispatcherStats{
+		Workers: vd.maxWorkers,
+		Pending: vd.pending.len(),
+		Paused:  vd.paused,
+	}
+	vd.mu.Unlock()
+
+	vd.statusMu.Lock()
+	defer vd.statusMu.Unlock()
+	for _, s := range vd.statuses {
+		switch s.State {
+		case JobRunning:
+			stats.BusyWorkers++
+		case JobQueued:
+			stats.Queued++
+		}
+	}
+
+	return stats
+}
+
+// setStatus records that job is now in the given state.
+func (vd *VideoDispatcher) setStatus(job VideoProcessingJob, state JobState, message string) {
+	vd.statusMu.Lock()
+	defer vd.statusMu.Unlock()
+
+	now := time.Now()
+	s, ok := vd.statuses[job.Video.ID]
+	if !ok || s.State.Finished() {
+		// A new job, or an old one being run again.
+		s = &JobStatus{QueuedAt: now}
+		vd.statuses[job.Video.ID] = s
+	}
+
+	s.ID = job.Video.ID
+	s.EncodingType = job.Video.EncodingType
+	s.Priority = job.Priority
+	s.State = state
+	s.Worker = 0
+	s.Attempts = job.Video.attempts
+	s.Message = message
+
+	switch {
+	case state == JobRunning:
+		s.Worker = job.worker
+		s.StartedAt = now
+		s.Progress = ProgressMessage{}
+	case state.Finished():
+		s.FinishedAt = now
+		vd.pruneStatuses(now)
+	}
+}
+
+// pruneStatuses drops the status of every job which finished longer ago than vd.KeepFinished,
+// and then of the jobs which finished first, until no more than vd.MaxFinished are left.
+// statusMu must be held.
+func (vd *VideoDispatcher) pruneStatuses(now time.Time) {
+	keep := vd.KeepFinished
+	if keep <= 0 {
+		keep = defaultKeepFinished
+	}
+	limit := vd.MaxFinished
+	if limit <= 0 {
+		limit = defaultMaxFinished
+	}
+
+	var finished []*JobStatus
+	for id, s := range vd.statuses {
+		switch {
+		case !s.State.Finished():
+		case now.Sub(s.FinishedAt) > keep:
+			delete(vd.statuses, id)
+		default:
+			finished = append(finished, s)
+		}
+	}
+	if len(finished) <= limit {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.Before(finished[j].FinishedAt)
+	})
+	for _, s := range finished[:len(finished)-limit] {
+		delete(vd.statuses, s.ID)
+	}
+}
+
+// dropStatus removes the status of the video with the given id, whatever its state.
+func (vd *VideoDispatcher) dropStatus(id int) {
+	vd.statusMu.Lock()
+	defer vd.statusMu.Unlock()
+
+	delete(vd.statuses, id)
+}
+
+// setProgress records msg as the latest progress of the video with the given id.
+func (vd *VideoDispatcher) setProgress(msg ProgressMessage) {
+	vd.statusMu.Lock()
+	defer vd.statusMu.Unlock()
+
+	if s, ok := vd.statuses[msg.ID]; ok && s.State == JobRunning {
+		s.Progress = msg
+	}
+}
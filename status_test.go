@@ -0,0 +1,133 @@
+package streamer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestVideoDispatcher_Status(t *testing.T) {
+	engine := testEncoderBlocking{started: make(chan int)}
+	wp := New(nil, 1, Processor{Engine: &engine})
+	wp.Run()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		wp.Shutdown(ctx)
+	}()
+
+	if _, ok := wp.Status(1); ok {
+		t.Error("expected no status for an unknown video")
+	}
+
+	// The first video occupies the only worker, and the second waits for it.
+	notifyChan := make(chan ProcessingMessage, 10)
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+	<-engine.started
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(2, "./a/b.mp4", "./testdata/output", "hls", notifyChan, nil), Priority: PriorityHigh})
+
+	s, ok := wp.Status(1)
+	if !ok || s.State != JobRunning || s.Worker != 1 || s.Attempts != 1 || s.StartedAt.IsZero() {
+		t.Errorf("expected video 1 to be running on worker 1 but got %+v", s)
+	}
+	s, ok = wp.Status(2)
+	if !ok || s.State != JobQueued || s.Worker != 0 || s.Priority != PriorityHigh || s.QueuedAt.IsZero() {
+		t.Errorf("expected video 2 to be queued but got %+v", s)
+	}
+
+	stats := wp.Stats()
+	if stats != (DispatcherStats{Workers: 1, BusyWorkers: 1, Pending: 1, Queued: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	tests := []struct {
+		name   string
+		filter StatusFilter
+		want   []int
+	}{
+		{name: "all", filter: StatusFilter{}, want: []int{1, 2}},
+		{name: "state", filter: StatusFilter{States: []JobState{JobQueued, JobFailed}}, want: []int{2}},
+		{name: "encoding type", filter: StatusFilter{EncodingType: "mp4"}, want: []int{1}},
+		{name: "none", filter: StatusFilter{States: []JobState{JobSucceeded}}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := wp.List(tt.filter)
+			if len(list) != len(tt.want) {
+				t.Fatalf("expected %d jobs but got %d", len(tt.want), len(list))
+			}
+			for i := range list {
+				if list[i].ID != tt.want[i] {
+					t.Errorf("expected video %d but got %d", tt.want[i], list[i].ID)
+				}
+			}
+		})
+	}
+
+	// Once the first video is cancelled, the second starts.
+	wp.Cancel(1)
+	<-notifyChan
+	<-engine.started
+
+	s, _ = wp.Status(1)
+	if s.State != JobCancelled || s.Worker != 0 || s.FinishedAt.IsZero() || s.Message != ErrCancelled.Error() {
+		t.Errorf("expected video 1 to be cancelled but got %+v", s)
+	}
+	if wp.Forget(2) {
+		t.Error("expected Forget to return false for a running video")
+	}
+	if !wp.Forget(1) {
+		t.Error("expected Forget to return true for a finished video")
+	}
+	if _, ok := wp.Status(1); ok {
+		t.Error("expected no status for a forgotten video")
+	}
+}
+
+func TestVideoDispatcher_Status_retention(t *testing.T) {
+	wp := New(nil, 1, testProcessor)
+	wp.MaxFinished = 2
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	for id := 1; id <= 3; id++ {
+		_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(id, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+		<-notifyChan
+	}
+
+	// Only the last two finished jobs are kept.
+	list := wp.List(StatusFilter{})
+	if len(list) != 2 || list[0].ID != 2 || list[1].ID != 3 {
+		t.Errorf("expected videos 2 and 3 to be kept but got %+v", list)
+	}
+
+	// Jobs which finished too long ago are dropped when the next one finishes.
+	wp.KeepFinished = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(4, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+	<-notifyChan
+	if list := wp.List(StatusFilter{}); len(list) != 1 || list[0].ID != 4 {
+		t.Errorf("expected only video 4 to be kept but got %+v", list)
+	}
+}
+
+func TestVideoDispatcher_Status_progress(t *testing.T) {
+	engine := testEncoderFunc{fn: func(v *Video) error {
+		v.sendProgress(ProgressMessage{ID: v.ID, Percent: 50})
+		return nil
+	}}
+	wp := New(nil, 1, Processor{Engine: &engine})
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+	<-notifyChan
+
+	s, _ := wp.Status(1)
+	if s.State != JobSucceeded || s.Progress.Percent != 50 {
+		t.Errorf("expected video 1 to have succeeded at 50%% progress but got %+v", s)
+	}
+}
@@ -0,0 +1,220 @@
+package streamer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobState is the state of a job, as recorded in a JobStore.
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"    // The dispatcher has taken the job, but it hasn't started.
+	JobRunning   JobState = "running"   // The job is being encoded.
+	JobSucceeded JobState = "succeeded" // The job was encoded successfully.
+	JobFailed    JobState = "failed"    // The encode failed.
+	JobCancelled JobState = "cancelled" // The job was cancelled.
+)
+
+// Finished returns true if a job in state s will not be run again.
+func (s JobState) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// JobRecord is what a JobStore keeps about a job: enough to rebuild the video and run it
+// again, along with what has happened to it so far.
+type JobRecord struct {
+	ID           int           `json:"id"`            // The ID of the video.
+	InputFile    string        `json:"input_file"`    // The path to the input file.
+	OutputDir    string        `json:"output_dir"`    // The path to the output directory.
+	EncodingType string        `json:"encoding_type"` // mp4, hls, hls-encrypted, dash, cmaf, or preview.
+	Options      *VideoOptions `json:"options"`       // Options for encoding.
+	Priority     int           `json:"priority"`      // The priority of the job.
+	State        JobState      `json:"state"`         // What has happened to the job so far.
+	Message      string        `json:"message"`       // The message sent to the client when the job finished.
+	UpdatedAt    time.Time     `json:"updated_at"`    // When the record was last saved.
+}
+
+// JobStore is an interface for persisting jobs, so that queued and running jobs survive a
+// restart of the process. Any type that wants to satisfy this interface must implement all
+// its methods, and be safe for concurrent use.
+type JobStore interface {
+	// Save creates or replaces the record for the job with the ID of rec.
+	Save(rec JobRecord) error
+	// Unfinished returns the records of every job which is queued or running.
+	Unfinished() ([]JobRecord, error)
+	// Delete removes the record for the job with the given id, if there is one. The dispatcher
+	// calls it once a job has finished, so that the store only holds jobs which may run again.
+	Delete(id int) error
+}
+
+// newJobRecord returns a record of job in the given state.
+func newJobRecord(job VideoProcessingJob, state JobState, message string) JobRecord {
+	v := job.Video
+	return JobRecord{
+		ID:           v.ID,
+		InputFile:    v.InputFile,
+		OutputDir:    v.OutputDir,
+		EncodingType: v.EncodingType,
+		Options:      v.Options,
+		Priority:     job.Priority,
+		State:        state,
+		Message:      message,
+		UpdatedAt:    time.Now(),
+	}
+}
+
+// FileJobStore is a JobStore which keeps each job in its own JSON file in a directory.
+// Records are written to a temporary file which is synced and then renamed over the old
+// record, and the directory is synced after the rename, so a crash never leaves a half-written
+// record behind, nor loses one which has been saved.
+type FileJobStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileJobStore returns a FileJobStore which keeps its records in dir, creating it if necessary.
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileJobStore{dir: dir}, nil
+}
+
+// Save writes rec to the store, replacing any existing record with the same ID.
+func (s *FileJobStore) Save(rec JobRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".job-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(rec.ID)); err != nil {
+		return err
+	}
+
+	return s.syncDir()
+}
+
+// Delete removes the record for the job with the given id. It is not an error if there is none.
+func (s *FileJobStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return s.syncDir()
+}
+
+// syncDir syncs the directory of the store, so that the files created, renamed, and removed
+// in it survive a crash.
+func (s *FileJobStore) syncDir() error {
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+// Get returns the record for the job with the given id, and false if there isn't one.
+func (s *FileJobStore) Get(id int) (JobRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.read(s.path(id))
+	if os.IsNotExist(err) {
+		return JobRecord{}, false, nil
+	}
+	if err != nil {
+		return JobRecord{}, false, err
+	}
+
+	return rec, true, nil
+}
+
+// Unfinished returns the records of every job which is queued or running, in order of ID.
+func (s *FileJobStore) Unfinished() ([]JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []JobRecord
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		rec, err := s.read(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if !rec.State.Finished() {
+			records = append(records, rec)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+
+	return records, nil
+}
+
+// path returns the path of the file holding the record for the job with the given id.
+func (s *FileJobStore) path(id int) string {
+	return filepath.Join(s.dir, strconv.Itoa(id)+".json")
+}
+
+// read reads the record in the file at path.
+func (s *FileJobStore) read(path string) (JobRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return JobRecord{}, err
+	}
+
+	var rec JobRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return JobRecord{}, fmt.Errorf("error reading job record %s: %w", path, err)
+	}
+
+	return rec, nil
+}
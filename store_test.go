@@ -0,0 +1,131 @@
+package streamer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileJobStore(t *testing.T) {
+	store, err := NewFileJobStore(filepath.Join(t.TempDir(), "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []JobRecord{
+		{ID: 3, InputFile: "c.mp4", EncodingType: "hls", State: JobRunning, Options: &VideoOptions{SegmentDuration: 10}},
+		{ID: 1, InputFile: "a.mp4", EncodingType: "mp4", State: JobQueued},
+		{ID: 2, InputFile: "b.mp4", EncodingType: "mp4", State: JobSucceeded},
+		{ID: 4, InputFile: "d.mp4", EncodingType: "mp4", State: JobFailed},
+	}
+	for _, rec := range records {
+		if err := store.Save(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Saving again replaces the record.
+	if err := store.Save(JobRecord{ID: 4, InputFile: "d.mp4", EncodingType: "mp4", State: JobQueued}); err != nil {
+		t.Fatal(err)
+	}
+
+	unfinished, err := store.Unfinished()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, rec := range unfinished {
+		ids = append(ids, rec.ID)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 3 || ids[2] != 4 {
+		t.Errorf("expected unfinished jobs 1, 3 and 4 but got %v", ids)
+	}
+	if unfinished[1].Options == nil || unfinished[1].Options.SegmentDuration != 10 {
+		t.Errorf("expected options to be saved but got %+v", unfinished[1].Options)
+	}
+
+	rec, ok, err := store.Get(2)
+	if err != nil || !ok || rec.State != JobSucceeded {
+		t.Errorf("expected job 2 to have succeeded but got %+v, %t, %v", rec, ok, err)
+	}
+	if _, ok, err := store.Get(99); ok || err != nil {
+		t.Errorf("expected no record for job 99 but got %t, %v", ok, err)
+	}
+
+	// Deleting a record removes it, and deleting a missing one is not an error.
+	if err := store.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.Get(2); ok || err != nil {
+		t.Errorf("expected job 2 to be deleted but got %t, %v", ok, err)
+	}
+	if err := store.Delete(99); err != nil {
+		t.Errorf("expected no error deleting a missing record but got %v", err)
+	}
+
+	// No temporary files should be left behind.
+	matches, _ := filepath.Glob(filepath.Join(store.dir, "*.tmp"))
+	if len(matches) != 0 {
+		t.Errorf("expected no temporary files but got %v", matches)
+	}
+
+	// A corrupt record is an error.
+	if err := os.WriteFile(store.path(5), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Unfinished(); err == nil {
+		t.Error("expected an error reading a corrupt record")
+	}
+}
+
+func TestVideoDispatcher_Store(t *testing.T) {
+	store, err := NewFileJobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Job 1 was running and job 2 was queued when the process last stopped.
+	_ = store.Save(JobRecord{ID: 1, InputFile: "./a/b.mp4", OutputDir: "./testdata/output", EncodingType: "mp4", State: JobRunning})
+	_ = store.Save(JobRecord{ID: 2, InputFile: "./a/b.mp4", OutputDir: "./testdata/output", EncodingType: "hls", State: JobQueued})
+	_ = store.Save(JobRecord{ID: 3, InputFile: "./a/b.mp4", OutputDir: "./testdata/output", EncodingType: "mp4", State: JobSucceeded})
+
+	videoQueue := make(chan VideoProcessingJob)
+	wp := New(videoQueue, 2)
+	wp.Processor = testProcessor
+	wp.Store = store
+	wp.Run()
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	n, err := wp.Recover(notifyChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 jobs to be recovered but got %d", n)
+	}
+
+	// A new job which fails.
+	v := wp.NewVideo(4, "./a/b.mp4", "./testdata/output", "fish", notifyChan, nil)
+	videoQueue <- VideoProcessingJob{Video: v}
+
+	for i := 0; i < 3; i++ {
+		<-notifyChan
+	}
+	if _, err := wp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recovered jobs and the new one have finished, so their records are gone. Job 3 had
+	// finished before, and is left alone.
+	for _, id := range []int{1, 2, 4} {
+		if rec, ok, err := store.Get(id); ok || err != nil {
+			t.Errorf("expected the record of job %d to be deleted but got %+v, %v", id, rec, err)
+		}
+	}
+
+	unfinished, err := store.Unfinished()
+	if err != nil || len(unfinished) != 0 {
+		t.Errorf("expected no unfinished jobs but got %v, %v", unfinished, err)
+	}
+}
@@ -1,11 +1,16 @@
 package streamer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/tsawler/toolbox"
+	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
 // Processor is a simple wrapper for anything that satisfies the Encoder interface.
@@ -16,21 +21,61 @@ type Processor struct {
 
 // ProcessingMessage is the information sent back to the client.
 type ProcessingMessage struct {
-	ID         int    `json:"id"`          // The ID of the video.
-	Successful bool   `json:"successful"`  // True if video was successfully encoded.
-	Message    string `json:"message"`     // A human-readable message.
-	OutputFile string `json:"output_file"` // The name of the generated file.
+	ID          int          `json:"id"`           // The ID of the video.
+	Successful  bool         `json:"successful"`   // True if video was successfully encoded.
+	Message     string       `json:"message"`      // A human-readable message.
+	OutputFile  string       `json:"output_file"`  // The name of the generated file.
+	OutputFiles []string     `json:"output_files"` // The names of all the generated manifests or files.
+	Cancelled   bool         `json:"cancelled"`    // True if the encode was cancelled before it finished.
+	TimedOut    bool         `json:"timed_out"`    // True if the encode failed because it took too long, or stalled.
+	Renditions  []string     `json:"renditions"`   // The names of the renditions produced, if reported by the encoder.
+	Poster      string       `json:"poster"`       // The name of the poster image, if thumbnails were asked for.
+	Thumbnails  []string     `json:"thumbnails"`   // The names of the thumbnail images, if any were asked for.
+	SpriteTrack string       `json:"sprite_track"` // The name of the WebVTT track of seek bar previews, if sprites were asked for.
+	Sprites     []string     `json:"sprites"`      // The names of the sprite sheets the track refers to, if reported by the encoder.
+	Subtitles   []string     `json:"subtitles"`    // The names of the WebVTT subtitle files, if reported by the encoder.
+	Attempts    int          `json:"attempts"`     // How many times the encode was attempted.
+	Err         error        `json:"-"`            // The error, for use with errors.Is and errors.As.
+	Diagnostics *EncodeError `json:"diagnostics"`  // If ffmpeg failed, its command line, exit code, and log.
 }
 
 // Video is the type for a video that we wish to process.
 type Video struct {
-	ID           int                    // An arbitrary ID for the video.
-	InputFile    string                 // The path to the input file.
-	OutputDir    string                 // The path to the output directory.
-	EncodingType string                 // mp4, hls, or hls-encrypted.
-	NotifyChan   chan ProcessingMessage // A channel to receive the output message.
-	Options      *VideoOptions          // Options for encoding.
-	Encoder      Processor              // The processing engine we'll use for encoding.
+	ID             int                    // An arbitrary ID for the video.
+	InputFile      string                 // The path to the input file.
+	OutputDir      string                 // The path to the output directory.
+	EncodingType   string                 // mp4, hls, hls-encrypted, dash, cmaf, or preview.
+	NotifyChan     chan ProcessingMessage // A channel to receive the output message.
+	Options        *VideoOptions          // Options for encoding.
+	Encoder        Processor              // The processing engine we'll use for encoding.
+	ProgressChan   chan ProgressMessage   // An optional channel to receive progress while encoding.
+	ctx            context.Context        // Cancelled when the encode should be abandoned.
+	renditionNames []string               // The renditions produced, as recorded by the encoder.
+	attempts       int                    // How many times the encode has been attempted, including this one.
+	baseFileName   string                 // The base name of the output files, once it has been chosen.
+	onProgress     func(ProgressMessage)  // If not nil, called with every progress message.
+	stallTimeout   time.Duration          // If above zero, how long ffmpeg may go without reporting progress before it is killed.
+	spriteSheets   []string               // The sprite sheets produced, as recorded by the encoder.
+	subtitleFiles  []string               // The WebVTT subtitle files produced, as recorded by the encoder.
+	abort          <-chan struct{}        // If not nil, closed when results should no longer be sent, e.g. once a shutdown is forced.
+	validated      bool                   // Set once the input has passed Validate, so that it isn't probed again.
+}
+
+// WithContext returns a copy of v with its context changed to ctx. If ctx is cancelled
+// before the video has been encoded, the encode is abandoned and a message with Cancelled
+// set to true is sent to the NotifyChan of the video.
+func (v Video) WithContext(ctx context.Context) Video {
+	v.ctx = ctx
+	return v
+}
+
+// Context returns the context of the video. Encoders should stop encoding and return
+// as soon as it is done. If no context has been set, context.Background() is returned.
+func (v *Video) Context() context.Context {
+	if v.ctx != nil {
+		return v.ctx
+	}
+	return context.Background()
 }
 
 // New creates and returns a new worker pool. The final parameter is optional, and if not specified
@@ -57,24 +102,47 @@ func New(jobQueue chan VideoProcessingJob, maxWorkers int, encoder ...Processor)
 		maxWorkers = 1
 	}
 
+	// Running encodes are killed by cancelling this context.
+	ctx, cancel := context.WithCancelCause(context.Background())
+
 	// Return VideoDispatcher.
 	return &VideoDispatcher{
 		jobQueue:   jobQueue,
 		maxWorkers: maxWorkers,
 		WorkerPool: workerPool,
 		Processor:  p,
+		wake:       make(chan struct{}, 1),
+		space:      make(chan struct{}, 1),
+		quit:       make(chan struct{}),
+		cancels:    make(map[int]jobCancels),
+		statuses:   make(map[int]*JobStatus),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
 // VideoOptions allows us to specify encoding options.
 type VideoOptions struct {
-	RenameOutput    bool   // If true, generate random name for output file.
-	Secret          string // For encrypted HLS, the name of the file with the secret.
-	KeyInfo         string // For encrypted HLS, the key info file.
-	SegmentDuration int    // If HLS, how long should segments be in seconds?
-	MaxRate1080p    string // The Maximum rate for 1080p encoding.
-	MaxRate720p     string // The Maximum rate for 720p encoding.
-	MaxRate480p     string // The Maximum rate for 480p encoding.
+	RenameOutput    bool              // If true, generate random name for output file.
+	Secret          string            // For encrypted HLS, the name of the file with the secret.
+	KeyInfo         string            // For encrypted HLS, the key info file.
+	SegmentDuration int               // If HLS, how long should segments be in seconds?
+	MaxRate1080p    string            // The Maximum rate for 1080p encoding.
+	MaxRate720p     string            // The Maximum rate for 720p encoding.
+	MaxRate480p     string            // The Maximum rate for 480p encoding.
+	Renditions      []Rendition       // The ladder for HLS, DASH, and CMAF. If empty, 1080p, 720p, and 480p are used.
+	AllowUpscale    bool              // If true, keep renditions which are taller than the source.
+	SilentAudio     bool              // If true, add a silent audio track to HLS, DASH, and CMAF output when the input has none.
+	SaveLog         bool              // If true, save the log output of ffmpeg to a .log file named after the output.
+	Validate        bool              // If true, probe the input and reject it if it has no usable video: before queueing with Submit, or before encoding otherwise.
+	AllowedCodecs   []string          // If not empty, validation rejects video in any other codec, e.g. []string{"h264", "hevc"}.
+	Timeout         time.Duration     // If above zero, how long an attempt at the encode may take. If zero, the Timeout of the dispatcher is used.
+	StallTimeout    time.Duration     // If above zero, how long ffmpeg may go without reporting progress. If zero, the StallTimeout of the dispatcher is used.
+	Thumbnails      *ThumbnailOptions // If not nil, the poster and thumbnails to take once the video has been encoded.
+	Sprites         *SpriteOptions    // If not nil, how to make sprite sheets and a WebVTT track for seek bar previews once the video has been encoded.
+	Preview         *PreviewOptions   // For the preview encoding type, how to make the preview. If nil, the defaults are used.
+	Subtitles       []Subtitle        // Sidecar subtitle files to add to the output.
+	BurnSubtitles   bool              // For MP4, if true, burn the first of Subtitles into the video rather than adding it as a track.
 }
 
 // NewVideo is a convenience factory method for creating video objects with sensible default values.
@@ -105,80 +173,253 @@ func (vd *VideoDispatcher) NewVideo(id int, input, output, encType string, notif
 	}
 }
 
-// encode allows us to encode the source file to one of the supported formats.
-func (v *Video) encode() {
-	var fileName string
+// encode allows us to encode the source file to one of the supported formats. The result
+// is sent to v.NotifyChan, unless the encode was killed because the dispatcher was shut down.
+// The error from the encoder, if any, is returned.
+func (v *Video) encode() error {
+	fileNames, err := v.run()
+	v.notify(fileNames, err)
+	return err
+}
+
+// run encodes the source file to the format given by v.EncodingType, and makes any images
+// asked for, and returns the names of the files produced, the first of which is the main
+// output file.
+func (v *Video) run() ([]string, error) {
+	// Don't bother starting if the encode has already been cancelled.
+	if err := v.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	// Reject bad input before ffmpeg gets anywhere near it, if we've been asked to and it
+	// wasn't checked when the job was submitted.
+	if v.Options.Validate && !v.validated {
+		if err := v.Validate(v.Context()); err != nil {
+			return nil, err
+		}
+	}
+
+	fileNames, err := v.transcode()
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Options.Thumbnails != nil {
+		if err := v.encodeExtra(v.Encoder.Engine.EncodeThumbnails); err != nil {
+			return nil, err
+		}
+	}
+	if v.Options.Sprites != nil {
+		if err := v.encodeExtra(v.Encoder.Engine.EncodeSprites); err != nil {
+			return nil, err
+		}
+	}
+
+	return fileNames, nil
+}
 
+// transcode encodes the source file to the format given by v.EncodingType, and returns the
+// names of the files produced, the first of which is the main output file.
+func (v *Video) transcode() ([]string, error) {
 	switch v.EncodingType {
 	case "mp4":
 		name, err := v.encodeToMP4()
 		if err != nil {
-			v.sendToNotifyChan(false, "", fmt.Sprintf("error processing %d: %s", v.ID, err.Error()))
-			return
+			return nil, err
 		}
-		fileName = fmt.Sprintf("%s.mp4", name)
+		return []string{fmt.Sprintf("%s.mp4", name)}, nil
 	case "hls":
 		name, err := v.encodeToHLS()
 		if err != nil {
-			v.sendToNotifyChan(false, "", fmt.Sprintf("error processing %d: %s", v.ID, err.Error()))
-			return
+			return nil, err
 		}
-		fileName = fmt.Sprintf("%s.m3u8", name)
+		return []string{fmt.Sprintf("%s.m3u8", name)}, nil
 	case "hls-encrypted":
 		name, err := v.encodeToHLSEncrypted()
 		if err != nil {
-			v.sendToNotifyChan(false, "", fmt.Sprintf("error processing %d: %s", v.ID, err.Error()))
-			return
+			return nil, err
+		}
+		return []string{fmt.Sprintf("%s.m3u8", name)}, nil
+	case "dash":
+		name, err := v.encodeToDASH()
+		if err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf("%s.mpd", name)}, nil
+	case "cmaf":
+		name, err := v.encodeToCMAF()
+		if err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf("%s.m3u8", name), fmt.Sprintf("%s.mpd", name)}, nil
+	case "preview":
+		name, err := v.encodeToPreview()
+		if err != nil {
+			return nil, err
 		}
-		fileName = fmt.Sprintf("%s.m3u8", name)
+		return v.previewOptions().fileNames(name), nil
 	default:
-		v.sendToNotifyChan(false, "", fmt.Sprintf("error processing for %d: invalid encoding type", v.ID))
+		return nil, fmt.Errorf("%w: invalid encoding type %q", ErrInvalidInput, v.EncodingType)
+	}
+}
+
+// notify sends the result of an encode to v.NotifyChan.
+func (v *Video) notify(fileNames []string, err error) {
+	if err != nil {
+		v.sendFailure(err)
 		return
 	}
 
 	// Encoding was successful.
-	v.sendToNotifyChan(true, fileName, fmt.Sprintf("Video ID #%d processed and saved as %s", v.ID, fmt.Sprintf("%s/%s", v.OutputDir, fileName)))
+	v.sendSuccess(fileNames)
 }
 
-// encodeToHLSEncrypted takes input file, from receiver v.InputFile, and encodes to HLS format
-// at 1080p, 720p, and 480p, putting resulting files in the output directory
-// specified in the receiver as v.OutputDir. The resulting files are encrypted.
-func (v *Video) encodeToHLSEncrypted() (string, error) {
-	// Make sure output directory exists.
-	var t toolbox.Tools
-	err := t.CreateDirIfNotExist(v.OutputDir)
-	if err != nil {
-		return "", err
+// sendSuccess reports a successful encode on the notify channel. The first of fileNames is
+// the main output file.
+func (v *Video) sendSuccess(fileNames []string) {
+	paths := make([]string, len(fileNames))
+	for i, name := range fileNames {
+		paths[i] = fmt.Sprintf("%s/%s", v.OutputDir, name)
 	}
 
-	baseFileName := ""
+	var poster, spriteTrack string
+	var thumbnails []string
+	if o := v.Options.Thumbnails; o != nil {
+		poster = o.posterName(v.baseFileName)
+		thumbnails = o.thumbnailNames(v.baseFileName)
+	}
+	if o := v.Options.Sprites; o != nil {
+		spriteTrack = o.trackName(v.baseFileName)
+	}
 
-	if !v.Options.RenameOutput {
-		// Get base filename.
-		b := path.Base(v.InputFile)
-		baseFileName = strings.TrimSuffix(b, filepath.Ext(b))
-	} else {
-		var t toolbox.Tools
-		baseFileName = t.RandomString(10)
+	v.send(ProcessingMessage{
+		ID:          v.ID,
+		Successful:  true,
+		Message:     fmt.Sprintf("Video ID #%d processed and saved as %s", v.ID, strings.Join(paths, " and ")),
+		OutputFile:  fileNames[0],
+		OutputFiles: fileNames,
+		Renditions:  v.renditionNames,
+		Poster:      poster,
+		Thumbnails:  thumbnails,
+		SpriteTrack: spriteTrack,
+		Sprites:     v.spriteSheets,
+		Subtitles:   v.subtitleFiles,
+		Attempts:    v.attempts,
+	})
+}
+
+// sendFailure reports a failed encode on the notify channel. Nothing is sent if the encode
+// was killed because the dispatcher was shut down, since the job is handed back to the
+// caller of Shutdown instead, and a cancellation is reported if the context of v is done,
+// unless the encode ran out of time.
+func (v *Video) sendFailure(err error) {
+	switch {
+	case errors.Is(context.Cause(v.Context()), ErrShutdown):
+		return
+	case v.Context().Err() != nil && !errors.Is(context.Cause(v.Context()), ErrTimeout):
+		v.sendCancelled()
+	default:
+		var diagnostics *EncodeError
+		errors.As(err, &diagnostics)
+
+		v.send(ProcessingMessage{
+			ID:          v.ID,
+			Message:     fmt.Sprintf("error processing %d: %s", v.ID, err.Error()),
+			TimedOut:    errors.Is(err, ErrTimeout),
+			Err:         err,
+			Attempts:    v.attempts,
+			Diagnostics: diagnostics,
+		})
 	}
+}
 
-	err = v.Encoder.Engine.EncodeToHLSEncrypted(v, baseFileName)
-	if err != nil {
-		return "", err
+// sendCancelled pushes a message down the notify channel saying that the encode was cancelled.
+func (v *Video) sendCancelled() {
+	v.send(ProcessingMessage{
+		ID:        v.ID,
+		Message:   fmt.Sprintf("processing %d cancelled", v.ID),
+		Cancelled: true,
+		Err:       context.Cause(v.Context()),
+		Attempts:  v.attempts,
+	})
+}
+
+// send pushes msg down v.NotifyChan, waiting for it to be read, unless v.abort is closed
+// first, since nobody may ever read it.
+func (v *Video) send(msg ProcessingMessage) {
+	select {
+	case v.NotifyChan <- msg:
+	case <-v.abort:
 	}
+}
 
-	return baseFileName, nil
+// encodeToHLSEncrypted takes input file, from receiver v.InputFile, and encodes to HLS format
+// at each rendition in the ladder, putting resulting files in the output directory
+// specified in the receiver as v.OutputDir. The resulting files are encrypted.
+func (v *Video) encodeToHLSEncrypted() (string, error) {
+	return v.encodeWith(v.Encoder.Engine.EncodeToHLSEncrypted)
 }
 
 // encodeToHLS takes input file, from receiver v.InputFile, and encodes to HLS format
-// at 1080p, 720p, and 480p, putting resulting files in the output directory
+// at each rendition in the ladder, putting resulting files in the output directory
 // specified in the receiver as v.OutputDir.
 func (v *Video) encodeToHLS() (string, error) {
+	return v.encodeWith(v.Encoder.Engine.EncodeToHLS)
+}
+
+// sendProgress pushes a progress message down the progress channel, if there is one. If the
+// channel is full the message is dropped, rather than holding up the encode.
+func (v *Video) sendProgress(msg ProgressMessage) {
+	if v.onProgress != nil {
+		v.onProgress(msg)
+	}
+
+	if v.ProgressChan == nil {
+		return
+	}
+
+	select {
+	case v.ProgressChan <- msg:
+	default:
+	}
+}
+
+// encodeToMP4 takes input file, from receiver v.InputFile, and encodes to MP4 format
+// putting resulting file in the output directory specified in the receiver as v.OutputDir.
+func (v *Video) encodeToMP4() (string, error) {
+	return v.encodeWith(v.Encoder.Engine.EncodeToMP4)
+}
+
+// encodeToDASH takes input file, from receiver v.InputFile, and encodes to MPEG-DASH format
+// at each rendition in the ladder, putting the manifest and segments in the output directory
+// specified in the receiver as v.OutputDir.
+func (v *Video) encodeToDASH() (string, error) {
+	return v.encodeWith(v.Encoder.Engine.EncodeToDASH)
+}
+
+// encodeToCMAF takes input file, from receiver v.InputFile, and encodes to fragmented MP4
+// segments at each rendition in the ladder, putting a DASH manifest, an HLS master playlist, and the
+// segments they share in the output directory specified in the receiver as v.OutputDir.
+func (v *Video) encodeToCMAF() (string, error) {
+	return v.encodeWith(v.Encoder.Engine.EncodeToCMAF)
+}
+
+// encodeToPreview takes input file, from receiver v.InputFile, and makes a short looping
+// preview of it, putting the resulting files in the output directory specified in the
+// receiver as v.OutputDir.
+func (v *Video) encodeToPreview() (string, error) {
+	return v.encodeWith(v.Encoder.Engine.EncodeToPreview)
+}
+
+// encodeWith makes sure the output directory exists, works out the base file name for the
+// output, and hands v to engine for encoding. If the encode is cut short, because the context
+// of v is done or it timed out, any partial output is removed.
+func (v *Video) encodeWith(engine func(v *Video, baseFileName string) error) (string, error) {
 	// Make sure output directory exists.
 	var t toolbox.Tools
 	err := t.CreateDirIfNotExist(v.OutputDir)
 	if err != nil {
-		return "", err
+		return "", classify(v.Context(), err, nil)
 	}
 
 	baseFileName := ""
@@ -188,52 +429,167 @@ func (v *Video) encodeToHLS() (string, error) {
 		b := path.Base(v.InputFile)
 		baseFileName = strings.TrimSuffix(b, filepath.Ext(b))
 	} else {
-		var t toolbox.Tools
 		baseFileName = t.RandomString(10)
 	}
+	v.baseFileName = baseFileName
 
-	err = v.Encoder.Engine.EncodeToHLS(v, baseFileName)
+	err = engine(v, baseFileName)
 	if err != nil {
+		if v.cutShort(err) {
+			v.removeOutput(baseFileName)
+		}
 		return "", err
 	}
+
 	return baseFileName, nil
 }
 
-// sendToNotifyChan pushes a message down the notify channel.
-func (v *Video) sendToNotifyChan(successful bool, fileName, message string) {
-	v.NotifyChan <- ProcessingMessage{
-		ID:         v.ID,
-		Successful: successful,
-		Message:    message,
-		OutputFile: fileName,
+// encodeExtra runs engine once v has been encoded, to make more output from it, such as
+// thumbnails. If this is cut short, everything written for the encode is removed.
+func (v *Video) encodeExtra(engine func(v *Video, baseFileName string) error) error {
+	err := engine(v, v.baseFileName)
+	if err != nil && v.cutShort(err) {
+		v.removeOutput(v.baseFileName)
 	}
+	return err
 }
 
-// encodeToMP4 takes input file, from receiver v.InputFile, and encodes to MP4 format
-// putting resulting file in the output directory specified in the receiver as v.OutputDir.
-func (v *Video) encodeToMP4() (string, error) {
-	// Make sure output directory exists.
-	var t toolbox.Tools
-	err := t.CreateDirIfNotExist(v.OutputDir)
+// cutShort returns true if err means that an encode of v was stopped before it finished,
+// because the context of v is done, or ffmpeg was killed for taking too long or stalling,
+// so that whatever it wrote is incomplete.
+func (v *Video) cutShort(err error) bool {
+	return v.Context().Err() != nil || errors.Is(err, ErrTimeout)
+}
+
+// logFile returns the path of the file which the log output of ffmpeg is saved to when
+// v.Options.SaveLog is set.
+func (v *Video) logFile() string {
+	name := v.baseFileName
+	if name == "" {
+		name = fmt.Sprintf("video-%d", v.ID)
+	}
+	return fmt.Sprintf("%s/%s.log", v.OutputDir, name)
+}
+
+// outputPrefixes are what the names of the files written for an encode start with, after the
+// base file name and a dash, other than those of the renditions: DASH and CMAF segments, CMAF
+// playlists, thumbnails, sprite sheets and their track, and subtitles.
+var outputPrefixes = []string{"init-", "chunk-", "media-", "poster.", "thumb-", "sprite-", "sprites.", "subs-"}
+
+// outputFiles returns the files in the output directory which belong to the encode with
+// the given base file name, e.g. name.mp4, name.m3u8, name-1080p.m3u8 and name-1080p0.ts.
+// Other files which happen to start with the base file name, such as name-final.mp4, are left out.
+func (v *Video) outputFiles(baseFileName string) []string {
+	entries, err := os.ReadDir(v.OutputDir)
 	if err != nil {
-		return "", err
+		return nil
 	}
 
-	baseFileName := ""
+	// The input and the subtitle files may well be in the output directory, and must never
+	// be mistaken for output.
+	sources := []string{v.InputFile}
+	if v.Options != nil {
+		for _, s := range v.Options.Subtitles {
+			sources = append(sources, s.File)
+		}
+	}
 
-	if !v.Options.RenameOutput {
-		// Get base filename.
-		b := path.Base(v.InputFile)
-		baseFileName = strings.TrimSuffix(b, filepath.Ext(b))
-	} else {
-		var t toolbox.Tools
-		baseFileName = t.RandomString(10)
+	var files []string
+	for _, e := range entries {
+		file := filepath.Join(v.OutputDir, e.Name())
+		if !e.IsDir() && v.isOutputFile(baseFileName, e.Name()) && !sameFile(file, sources) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// outputExtensions returns the extensions of the files named after the base file name which
+// an encode of v writes, e.g. "mp4" for name.mp4, and "log" for the saved ffmpeg log.
+func (v *Video) outputExtensions() []string {
+	extensions := []string{"log"}
+	switch v.EncodingType {
+	case "mp4":
+		extensions = append(extensions, "mp4")
+	case "hls", "hls-encrypted":
+		extensions = append(extensions, "m3u8")
+	case "dash":
+		extensions = append(extensions, "mpd")
+	case "cmaf":
+		extensions = append(extensions, "mpd", "m3u8")
+	case "preview":
+		o := v.previewOptions()
+		extensions = append(extensions, o.format())
+		if o.MP4 {
+			extensions = append(extensions, "mp4")
+		}
 	}
+	return extensions
+}
 
-	err = v.Encoder.Engine.EncodeToMP4(v, baseFileName)
+// isOutputFile reports whether name is the name of a file written by the encode of v with the
+// given base file name.
+func (v *Video) isOutputFile(baseFileName, name string) bool {
+	if ext, ok := strings.CutPrefix(name, baseFileName+"."); ok {
+		return slices.Contains(v.outputExtensions(), ext)
+	}
+
+	rest, ok := strings.CutPrefix(name, baseFileName+"-")
+	if !ok {
+		return false
+	}
+	for _, prefix := range outputPrefixes {
+		if strings.HasPrefix(rest, prefix) {
+			return true
+		}
+	}
+
+	// The playlist of a rendition, e.g. name-720p.m3u8, and its segments, e.g. name-720p12.ts.
+	for _, r := range v.renditionNames {
+		if after, ok := strings.CutPrefix(rest, r); ok {
+			segment := strings.TrimLeft(after, "0123456789")
+			if after == ".m3u8" || (segment == ".ts" && len(after) > len(segment)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameFile returns true if file is one of paths, once both are made absolute.
+func sameFile(file string, paths []string) bool {
+	abs, err := filepath.Abs(file)
 	if err != nil {
-		return "", err
+		return false
+	}
+	for _, p := range paths {
+		if other, err := filepath.Abs(p); err == nil && other == abs {
+			return true
+		}
 	}
+	return false
+}
 
-	return baseFileName, nil
+// removeOutput deletes the files in the output directory which belong to the encode
+// with the given base file name.
+func (v *Video) removeOutput(baseFileName string) {
+	for _, f := range v.outputFiles(baseFileName) {
+		_ = os.Remove(f)
+	}
+}
+
+// outputSize returns the total size in bytes of the files in the output directory which belong
+// to the last encode of v, or 0 if it didn't get as far as choosing their names.
+func (v *Video) outputSize() int64 {
+	if v.baseFileName == "" {
+		return 0
+	}
+
+	var size int64
+	for _, f := range v.outputFiles(v.baseFileName) {
+		if info, err := os.Stat(f); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+	}
+	return size
 }
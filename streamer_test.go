@@ -1,8 +1,14 @@
 package streamer
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -105,6 +111,13 @@ func Test_encode(t *testing.T) {
 		{name: "hls encrypted invalid output", output: "/foo", args: args{6, "hls-encrypted", &VideoOptions{RenameOutput: false}}, expectSuccess: false, useFailEncoder: false},
 		{name: "hls encrypted rename", output: "./testdata/output", args: args{7, "hls-encrypted", &VideoOptions{RenameOutput: true}}, expectSuccess: true, useFailEncoder: false},
 		{name: "hls encrypted_fail", output: "./testdata/output", args: args{8, "hls-encrypted", &VideoOptions{RenameOutput: true}}, expectSuccess: false, useFailEncoder: true},
+		{name: "dash", output: "./testdata/output", args: args{9, "dash", &VideoOptions{RenameOutput: false}}, expectSuccess: true, useFailEncoder: false},
+		{name: "dash invalid output", output: "/foo", args: args{9, "dash", &VideoOptions{RenameOutput: false}}, expectSuccess: false, useFailEncoder: false},
+		{name: "dash_fail", output: "./testdata/output", args: args{10, "dash", &VideoOptions{RenameOutput: true}}, expectSuccess: false, useFailEncoder: true},
+		{name: "cmaf", output: "./testdata/output", args: args{11, "cmaf", &VideoOptions{RenameOutput: false}}, expectSuccess: true, useFailEncoder: false},
+		{name: "cmaf_fail", output: "./testdata/output", args: args{12, "cmaf", &VideoOptions{RenameOutput: true}}, expectSuccess: false, useFailEncoder: true},
+		{name: "preview", output: "./testdata/output", args: args{13, "preview", &VideoOptions{Preview: &PreviewOptions{MP4: true}}}, expectSuccess: true, useFailEncoder: false},
+		{name: "preview_fail", output: "./testdata/output", args: args{14, "preview", nil}, expectSuccess: false, useFailEncoder: true},
 		{name: "invalid encoding type", output: "./testdata/output", args: args{9, "fish", &VideoOptions{RenameOutput: true}}, expectSuccess: false},
 	}
 
@@ -123,6 +136,9 @@ func Test_encode(t *testing.T) {
 		if result.Successful != tt.expectSuccess {
 			t.Errorf("%s: expected result.Successful of %t but got %t", tt.name, tt.expectSuccess, result.Successful)
 		}
+		if result.Successful && (len(result.OutputFiles) == 0 || result.OutputFiles[0] != result.OutputFile) {
+			t.Errorf("%s: expected output files to start with %s but got %v", tt.name, result.OutputFile, result.OutputFiles)
+		}
 	}
 }
 
@@ -161,3 +177,540 @@ func Test_pool(t *testing.T) {
 		})
 	}
 }
+
+func TestVideoDispatcher_Shutdown(t *testing.T) {
+	videoQueue := make(chan VideoProcessingJob)
+	wp := New(videoQueue, 3)
+	wp.Processor = testProcessor
+	wp.Run()
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	for i := 1; i <= 3; i++ {
+		v := wp.NewVideo(i, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)
+		videoQueue <- VideoProcessingJob{Video: v}
+	}
+
+	for i := 0; i < 3; i++ {
+		if result := <-notifyChan; !result.Successful {
+			t.Errorf("video %d: encoding failed", result.ID)
+		}
+	}
+
+	abandoned, err := wp.Shutdown(context.Background())
+	if err != nil {
+		t.Errorf("unexpected error from Shutdown: %s", err)
+	}
+	if len(abandoned) != 0 {
+		t.Errorf("expected no abandoned jobs but got %d", len(abandoned))
+	}
+
+	// Shutting down a second time should do no harm.
+	if _, err := wp.Shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected error from second Shutdown: %s", err)
+	}
+}
+
+func TestVideoDispatcher_Shutdown_timeout(t *testing.T) {
+	videoQueue := make(chan VideoProcessingJob)
+	engine := testEncoderBlocking{started: make(chan int)}
+	wp := New(videoQueue, 1, Processor{Engine: &engine})
+	wp.Run()
+
+	notifyChan := make(chan ProcessingMessage, 10)
+
+	// The first video occupies the only worker, and the second waits for it.
+	v1 := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)
+	videoQueue <- VideoProcessingJob{Video: v1}
+	<-engine.started
+	v2 := wp.NewVideo(2, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)
+	videoQueue <- VideoProcessingJob{Video: v2}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	abandoned, err := wp.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded but got %v", err)
+	}
+
+	ids := map[int]bool{}
+	for _, job := range abandoned {
+		ids[job.Video.ID] = true
+	}
+	if len(abandoned) != 2 || !ids[1] || !ids[2] {
+		t.Errorf("expected videos 1 and 2 to be abandoned but got %v", ids)
+	}
+
+	if len(notifyChan) != 0 {
+		t.Errorf("expected no messages for abandoned jobs but got %d", len(notifyChan))
+	}
+	if stats := wp.Stats(); stats.Queued != 0 || stats.BusyWorkers != 0 {
+		t.Errorf("expected abandoned jobs not to be counted but got %+v", stats)
+	}
+}
+
+func TestVideoDispatcher_Shutdown_unread(t *testing.T) {
+	started := make(chan struct{})
+	engine := testEncoderFunc{fn: func(v *Video) error {
+		close(started)
+		return nil
+	}}
+	wp := New(nil, 1, Processor{Engine: &engine})
+	wp.Run()
+
+	// Nobody reads the result, so the worker can't hand it over.
+	notifyChan := make(chan ProcessingMessage)
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		_, err := wp.Shutdown(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context.DeadlineExceeded but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Shutdown to return once its context was done")
+	}
+}
+
+func TestVideoDispatcher_Cancel(t *testing.T) {
+	videoQueue := make(chan VideoProcessingJob)
+	engine := testEncoderBlocking{started: make(chan int)}
+	wp := New(videoQueue, 1, Processor{Engine: &engine})
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	notifyChan := make(chan ProcessingMessage, 10)
+
+	if wp.Cancel(1) {
+		t.Error("expected Cancel to return false for an unknown video")
+	}
+
+	// The first video occupies the only worker, and the second waits for it.
+	v1 := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)
+	videoQueue <- VideoProcessingJob{Video: v1}
+	<-engine.started
+	v2 := wp.NewVideo(2, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)
+	videoQueue <- VideoProcessingJob{Video: v2}
+
+	for _, id := range []int{2, 1} {
+		// The dispatcher may not have finished taking the job from the queue yet.
+		deadline := time.Now().Add(time.Second)
+		for !wp.Cancel(id) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected Cancel to return true for video %d", id)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		result := <-notifyChan
+		if result.ID != id || !result.Cancelled || result.Successful {
+			t.Errorf("expected video %d to be cancelled but got %+v", id, result)
+		}
+	}
+}
+
+func TestVideoDispatcher_sameVideo(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	engine := testEncoderFunc{fn: func(v *Video) error {
+		if v.EncodingType != "mp4" {
+			return nil
+		}
+		close(started)
+		select {
+		case <-release:
+			return nil
+		case <-v.Context().Done():
+			return context.Cause(v.Context())
+		}
+	}}
+	wp := New(nil, 2, Processor{Engine: &engine})
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	// Two jobs for the same video run at once, and the second finishes first.
+	notifyChan := make(chan ProcessingMessage, 10)
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(7, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+	<-started
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: wp.NewVideo(7, "./a/b.mp4", "./testdata/output", "hls", notifyChan, nil)})
+	if result := <-notifyChan; !result.Successful {
+		t.Fatalf("expected the hls job to succeed but got %+v", result)
+	}
+
+	// The first is still running, and is not cancelled by the second finishing.
+	close(release)
+	if result := <-notifyChan; !result.Successful || result.Cancelled {
+		t.Errorf("expected the mp4 job to succeed but got %+v", result)
+	}
+}
+
+func TestVideo_WithContext(t *testing.T) {
+	videoQueue := make(chan VideoProcessingJob)
+	wp := New(videoQueue, 1)
+	wp.Processor = testProcessor
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	notifyChan := make(chan ProcessingMessage, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	v := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil).WithContext(ctx)
+	videoQueue <- VideoProcessingJob{Video: v}
+
+	result := <-notifyChan
+	if !result.Cancelled || result.Successful {
+		t.Errorf("expected video to be cancelled but got %+v", result)
+	}
+}
+
+func TestVideo_removeOutput(t *testing.T) {
+	dir := t.TempDir()
+	// The upload and its subtitles are in the output directory too.
+	v := Video{
+		InputFile:      filepath.Join(dir, "intro.mp4"),
+		OutputDir:      dir,
+		EncodingType:   "hls",
+		Options:        &VideoOptions{Subtitles: []Subtitle{{File: filepath.Join(dir, "intro-subs-en.srt")}}},
+		renditionNames: []string{"720p", "480p"},
+	}
+
+	ours := []string{
+		"intro.m3u8", "intro.log", "intro-720p.m3u8", "intro-720p0.ts", "intro-480p12.ts",
+		"intro-init-0.m4s", "intro-chunk-0-00001.m4s", "intro-media-0.m3u8", "intro-poster.jpg", "intro-thumb-320-001.jpg",
+		"intro-sprite-001.jpg", "intro-sprites.vtt", "intro-subs-1.vtt",
+	}
+	others := []string{
+		"intro.mp4", "intro-subs-en.srt", "intro.srt", "intro.mpd",
+		"intro-final.mp4", "intro.final.mp4", "intro-720p-final.mp4", "intro-720px.ts", "introduction.mp4",
+	}
+	for _, name := range append(ours, others...) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v.baseFileName = "intro"
+	if size := v.outputSize(); size != int64(len(ours)) {
+		t.Errorf("expected output size %d but got %d", len(ours), size)
+	}
+
+	v.removeOutput("intro")
+	for _, name := range ours {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	for _, name := range others {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be kept but got %v", name, err)
+		}
+	}
+}
+
+func TestVideo_encodeWith_timeout(t *testing.T) {
+	dir := t.TempDir()
+	wp := New(make(chan VideoProcessingJob), 1)
+	v := wp.NewVideo(1, "./a/b.mp4", dir, "mp4", testNotifyChan, nil)
+
+	// A stalled ffmpeg is killed by the watchdog, which leaves the context of the video alone.
+	_, err := v.encodeWith(func(v *Video, baseFileName string) error {
+		_ = os.WriteFile(filepath.Join(v.OutputDir, baseFileName+".mp4"), []byte("partial"), 0644)
+		return fmt.Errorf("%w: no progress from ffmpeg for 1s", ErrTimeout)
+	})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout but got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.mp4")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the partial output to be removed but got %v", err)
+	}
+}
+
+func TestVideoDispatcher_priority(t *testing.T) {
+	videoQueue := make(chan VideoProcessingJob)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var order []int
+	engine := testEncoderFunc{fn: func(v *Video) error {
+		if v.ID == 1 {
+			close(started)
+			<-release
+		}
+		order = append(order, v.ID)
+		return nil
+	}}
+	wp := New(videoQueue, 1, Processor{Engine: &engine})
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	notifyChan := make(chan ProcessingMessage, 10)
+
+	// The first video occupies the only worker, and the rest wait for it.
+	jobs := []VideoProcessingJob{
+		{Video: wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)},
+		{Video: wp.NewVideo(2, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil), Priority: PriorityLow},
+		{Video: wp.NewVideo(3, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil), Priority: PriorityHigh},
+		{Video: wp.NewVideo(4, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)},
+	}
+	videoQueue <- jobs[0]
+	<-started
+	for _, job := range jobs[1:] {
+		videoQueue <- job
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		wp.mu.Lock()
+		n := wp.pending.len()
+		wp.mu.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 3 jobs to be waiting but got %d", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	for range jobs {
+		<-notifyChan
+	}
+
+	want := []int{1, 3, 4, 2}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected videos to be encoded in the order %v but got %v", want, order)
+		}
+	}
+}
+
+func TestVideoDispatcher_Submit(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow OverflowPolicy
+		want     error
+	}{
+		{name: "reject", overflow: OverflowReject, want: ErrQueueFull},
+		{name: "block", overflow: OverflowBlock, want: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := testEncoderBlocking{started: make(chan int)}
+			wp := New(nil, 1, Processor{Engine: &engine})
+			wp.MaxPending = 2
+			wp.Overflow = tt.overflow
+			wp.Run()
+
+			notifyChan := make(chan ProcessingMessage, 10)
+			submit := func(id int) error {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				return wp.Submit(ctx, VideoProcessingJob{Video: wp.NewVideo(id, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)})
+			}
+
+			// The first video occupies the only worker, and the next two fill the queue.
+			if err := submit(1); err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			<-engine.started
+			for id := 2; id <= 3; id++ {
+				if err := submit(id); err != nil {
+					t.Fatalf("expected no error for video %d but got %v", id, err)
+				}
+			}
+
+			if err := submit(4); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v but got %v", tt.want, err)
+			}
+
+			// Cancelling a waiting video makes room for another.
+			wp.Cancel(2)
+			<-notifyChan
+			if err := submit(5); err != nil {
+				t.Errorf("expected no error once there was room but got %v", err)
+			}
+
+			// The first video is killed, and the other two never start.
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			abandoned, _ := wp.Shutdown(ctx)
+			if len(abandoned) != 3 {
+				t.Errorf("expected 3 abandoned jobs but got %d", len(abandoned))
+			}
+
+			if err := submit(6); !errors.Is(err, ErrShutdown) {
+				t.Errorf("expected %v after shutdown but got %v", ErrShutdown, err)
+			}
+		})
+	}
+}
+
+func TestVideoDispatcher_MaxPending_reject(t *testing.T) {
+	videoQueue := make(chan VideoProcessingJob)
+	engine := testEncoderBlocking{started: make(chan int)}
+	wp := New(videoQueue, 1, Processor{Engine: &engine})
+	wp.MaxPending = 1
+	wp.Overflow = OverflowReject
+	wp.Run()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		wp.Shutdown(ctx)
+	}()
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	for id := 1; id <= 2; id++ {
+		videoQueue <- VideoProcessingJob{Video: wp.NewVideo(id, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)}
+		if id == 1 {
+			<-engine.started
+		}
+	}
+
+	// The third and fourth videos find the queue full, since the second is waiting for the
+	// worker. Nobody is reading their notify channel yet, which mustn't hold up the job queue.
+	rejected := make(chan ProcessingMessage)
+	for id := 3; id <= 4; id++ {
+		select {
+		case videoQueue <- VideoProcessingJob{Video: wp.NewVideo(id, "./a/b.mp4", "./testdata/output", "mp4", rejected, nil)}:
+		case <-time.After(time.Second):
+			t.Fatalf("video %d was not taken from the job queue", id)
+		}
+	}
+
+	for range 2 {
+		result := <-rejected
+		if (result.ID != 3 && result.ID != 4) || result.Successful || !errors.Is(result.Err, ErrQueueFull) {
+			t.Errorf("expected videos 3 and 4 to be rejected but got %+v", result)
+		}
+	}
+}
+
+func TestVideoDispatcher_MaxPending_unread(t *testing.T) {
+	videoQueue := make(chan VideoProcessingJob)
+	engine := testEncoderBlocking{started: make(chan int)}
+	wp := New(videoQueue, 1, Processor{Engine: &engine})
+	wp.MaxPending = 1
+	wp.Overflow = OverflowReject
+	wp.Run()
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	videoQueue <- VideoProcessingJob{Video: wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)}
+	<-engine.started
+	videoQueue <- VideoProcessingJob{Video: wp.NewVideo(2, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)}
+
+	// The rejection of the third video is never read, which mustn't hold up Shutdown.
+	videoQueue <- VideoProcessingJob{Video: wp.NewVideo(3, "./a/b.mp4", "./testdata/output", "mp4", make(chan ProcessingMessage), nil)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		wp.Shutdown(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Shutdown to return")
+	}
+}
+
+func TestVideoDispatcher_Pause(t *testing.T) {
+	videoQueue := make(chan VideoProcessingJob)
+	engine := testEncoderBlocking{started: make(chan int)}
+	wp := New(videoQueue, 2, Processor{Engine: &engine})
+	wp.Run()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		wp.Shutdown(ctx)
+	}()
+
+	notifyChan := make(chan ProcessingMessage, 10)
+	videoQueue <- VideoProcessingJob{Video: wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)}
+	<-engine.started
+
+	// While paused, the running video carries on, and new ones wait.
+	wp.Pause()
+	if !wp.Paused() || !wp.Stats().Paused {
+		t.Error("expected the dispatcher to be paused")
+	}
+	videoQueue <- VideoProcessingJob{Video: wp.NewVideo(2, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)}
+	videoQueue <- VideoProcessingJob{Video: wp.NewVideo(3, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)}
+	select {
+	case id := <-engine.started:
+		t.Fatalf("expected no video to start while paused but video %d did", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if s, _ := wp.Status(1); s.State != JobRunning {
+		t.Errorf("expected video 1 to be running but it is %s", s.State)
+	}
+	if n := wp.Stats().Pending; n != 2 {
+		t.Errorf("expected 2 videos to be waiting but got %d", n)
+	}
+
+	// Once resumed, the waiting videos start.
+	wp.Resume()
+	if wp.Paused() {
+		t.Error("expected the dispatcher not to be paused")
+	}
+	<-engine.started
+	wp.Cancel(1)
+	<-notifyChan
+	<-engine.started
+}
+
+func TestVideoDispatcher_Timeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		ops     *VideoOptions
+	}{
+		{name: "dispatcher default", timeout: 20 * time.Millisecond},
+		{name: "video option", timeout: time.Hour, ops: &VideoOptions{Timeout: 20 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := testEncoderBlocking{}
+			wp := New(nil, 1, Processor{Engine: &engine})
+			wp.Timeout = tt.timeout
+			wp.Run()
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				wp.Shutdown(ctx)
+			}()
+
+			notifyChan := make(chan ProcessingMessage, 10)
+			v := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, tt.ops)
+			if err := wp.Submit(context.Background(), VideoProcessingJob{Video: v}); err != nil {
+				t.Fatal(err)
+			}
+
+			// A timeout is a failure, not a cancellation.
+			select {
+			case result := <-notifyChan:
+				if result.Successful || result.Cancelled || !result.TimedOut || !errors.Is(result.Err, ErrTimeout) {
+					t.Errorf("expected the video to time out but got %+v", result)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected the video to time out")
+			}
+			if s, _ := wp.Status(1); s.State != JobFailed {
+				t.Errorf("expected the job to have failed but it is %s", s.State)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package streamer
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Subtitle is a sidecar subtitle file to add to a video. For HLS, MPEG-DASH, and CMAF, it is
+// converted to WebVTT and added to the manifests; for MP4, it is added as a subtitle track, or
+// burned into the video if VideoOptions.BurnSubtitles is set.
+type Subtitle struct {
+	File     string // The path to the subtitle file, in SRT, WebVTT, or ASS format.
+	Language string // The language, e.g. "en". MP4 needs a three letter code, e.g. "eng".
+	Label    string // The name players show for the subtitles, e.g. "English". If empty, the language.
+	Default  bool   // If true, players show these subtitles unless the viewer chooses otherwise.
+}
+
+// subtitleFormats are the extensions of the subtitle files we accept.
+var subtitleFormats = []string{".srt", ".vtt", ".ass", ".ssa"}
+
+// mpegtsStart is the timestamp, in 90kHz units, of the start of MPEG-TS output from ffmpeg,
+// which is 1.4 seconds in. WebVTT segments of HLS output have to say so, or players show the
+// subtitles early.
+const mpegtsStart = 126000
+
+// subtitleGroup is the ID of the group of subtitle renditions in an HLS master playlist.
+const subtitleGroup = "subs"
+
+// label returns the name players show for s, the ith subtitle, counting from one.
+func (s Subtitle) label(i int) string {
+	switch {
+	case s.Label != "":
+		return s.Label
+	case s.Language != "":
+		return s.Language
+	default:
+		return fmt.Sprintf("Subtitles %d", i)
+	}
+}
+
+// validateSubtitles returns an error matching ErrInvalidInput if any of subs can't be used.
+func validateSubtitles(subs []Subtitle) error {
+	for _, s := range subs {
+		if !slices.Contains(subtitleFormats, strings.ToLower(filepath.Ext(s.File))) {
+			return fmt.Errorf("%w: unsupported subtitle file %q", ErrInvalidInput, s.File)
+		}
+	}
+	return nil
+}
+
+// subtitleName returns the file name of the WebVTT version of the ith subtitle, counting from one.
+func subtitleName(baseFileName string, i int) string {
+	return fmt.Sprintf("%s-subs-%d.vtt", baseFileName, i)
+}
+
+// subtitlePlaylistName returns the file name of the HLS playlist of the ith subtitle.
+func subtitlePlaylistName(baseFileName string, i int) string {
+	return fmt.Sprintf("%s-subs-%d.m3u8", baseFileName, i)
+}
+
+// subtitlePlaylist returns an HLS playlist for a video of the given duration, whose only
+// segment is the whole of the given WebVTT file.
+func subtitlePlaylist(vttName string, duration time.Duration) string {
+	return fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:%s,\n%s\n#EXT-X-ENDLIST\n",
+		int(math.Ceil(duration.Seconds())), seconds(duration), vttName)
+}
+
+// withTimestampMap returns the WebVTT file vtt with a header saying that its times are
+// relative to the start of the MPEG-TS segments of the video.
+func withTimestampMap(vtt string) string {
+	header, rest, _ := strings.Cut(vtt, "\n")
+	return fmt.Sprintf("%s\nX-TIMESTAMP-MAP=MPEGTS:%d,LOCAL:00:00:00.000\n%s", strings.TrimRight(header, "\r"), mpegtsStart, rest)
+}
+
+// hlsQuote returns s as a quoted string attribute of an HLS tag, which may not contain quotes
+// or line breaks.
+func hlsQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, "'", "\n", " ", "\r", " ").Replace(s) + `"`
+}
+
+// hlsSubtitleMaster returns the HLS master playlist master, with a subtitle rendition for
+// each of subs, which every variant stream uses.
+func hlsSubtitleMaster(master, baseFileName string, subs []Subtitle) string {
+	var media strings.Builder
+	for i, s := range subs {
+		fmt.Fprintf(&media, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=%s,NAME=%s,", hlsQuote(subtitleGroup), hlsQuote(s.label(i+1)))
+		if s.Language != "" {
+			fmt.Fprintf(&media, "LANGUAGE=%s,", hlsQuote(s.Language))
+		}
+		defaultValue := "NO"
+		if s.Default {
+			defaultValue = "YES"
+		}
+		fmt.Fprintf(&media, "DEFAULT=%s,AUTOSELECT=YES,URI=%s\n", defaultValue, hlsQuote(subtitlePlaylistName(baseFileName, i+1)))
+	}
+
+	// The renditions go before the first variant stream, each of which is told to use them.
+	var b strings.Builder
+	added := false
+	for _, line := range strings.SplitAfter(master, "\n") {
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			if !added {
+				b.WriteString(media.String())
+				added = true
+			}
+			line = strings.TrimRight(line, "\r\n") + fmt.Sprintf(",SUBTITLES=%s\n", hlsQuote(subtitleGroup))
+		}
+		b.WriteString(line)
+	}
+
+	return b.String()
+}
+
+// dashSubtitleManifest returns the MPEG-DASH manifest mpd, with a text adaptation set for each
+// of subs, numbered from firstID.
+func dashSubtitleManifest(mpd, baseFileName string, subs []Subtitle, firstID int) (string, error) {
+	end := strings.LastIndex(mpd, "</Period>")
+	if end < 0 {
+		return "", errors.New("no period in the manifest")
+	}
+	// Keep the indentation of the closing tag.
+	end = strings.LastIndex(mpd[:end], "\n") + 1
+
+	var b strings.Builder
+	for i, s := range subs {
+		fmt.Fprintf(&b, "\t\t<AdaptationSet id=\"%d\" contentType=\"text\" mimeType=\"text/vtt\"", firstID+i)
+		if s.Language != "" {
+			fmt.Fprintf(&b, " lang=\"%s\"", xmlEscape(s.Language))
+		}
+		b.WriteString(">\n")
+		b.WriteString("\t\t\t<Role schemeIdUri=\"urn:mpeg:dash:role:2011\" value=\"subtitle\"/>\n")
+		fmt.Fprintf(&b, "\t\t\t<Label>%s</Label>\n", xmlEscape(s.label(i+1)))
+		fmt.Fprintf(&b, "\t\t\t<Representation id=\"subtitle-%d\" bandwidth=\"256\">\n", i+1)
+		fmt.Fprintf(&b, "\t\t\t\t<BaseURL>%s</BaseURL>\n", xmlEscape(subtitleName(baseFileName, i+1)))
+		b.WriteString("\t\t\t</Representation>\n")
+		b.WriteString("\t\t</AdaptationSet>\n")
+	}
+
+	return mpd[:end] + b.String() + mpd[end:], nil
+}
+
+// xmlEscape returns s escaped for use in XML text or attributes.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// filterValue returns s escaped for use as the value of an option of a filter in a filter
+// graph, e.g. a file name which may contain colons or quotes.
+func filterValue(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(s)
+}
+
+// convertSubtitles converts each of the subtitles of v to WebVTT in the output directory. If
+// timestampMap is set, the files say that they go with MPEG-TS segments made by ffmpeg. The
+// names of the files are recorded in v, so that they can be reported back to the client.
+func (ve *VideoEncoder) convertSubtitles(v *Video, baseFileName string, timestampMap bool) error {
+	for i, s := range v.Options.Subtitles {
+		name := subtitleName(baseFileName, i+1)
+		path := fmt.Sprintf("%s/%s", v.OutputDir, name)
+		if err := ve.runFFmpeg(v, "-y", "-i", s.File, "-map", "0:s:0", "-c:s", "webvtt", path); err != nil {
+			return err
+		}
+
+		if timestampMap {
+			vtt, err := os.ReadFile(path)
+			if err != nil {
+				return classify(v.Context(), err, nil)
+			}
+			if err := os.WriteFile(path, []byte(withTimestampMap(string(vtt))), 0644); err != nil {
+				return classify(v.Context(), err, nil)
+			}
+		}
+
+		v.subtitleFiles = append(v.subtitleFiles, name)
+	}
+	return nil
+}
+
+// addHLSSubtitles adds the subtitles of v to its HLS output, which has the given duration:
+// the WebVTT files, a playlist for each, and a subtitle rendition for each in the master playlist.
+func (ve *VideoEncoder) addHLSSubtitles(v *Video, baseFileName string, duration time.Duration, timestampMap bool) error {
+	subs := v.Options.Subtitles
+	if len(subs) == 0 {
+		return nil
+	}
+
+	if err := ve.convertSubtitles(v, baseFileName, timestampMap); err != nil {
+		return err
+	}
+	for i := range subs {
+		playlist := subtitlePlaylist(subtitleName(baseFileName, i+1), duration)
+		if err := os.WriteFile(fmt.Sprintf("%s/%s", v.OutputDir, subtitlePlaylistName(baseFileName, i+1)), []byte(playlist), 0644); err != nil {
+			return classify(v.Context(), err, nil)
+		}
+	}
+
+	masterPath := fmt.Sprintf("%s/%s.m3u8", v.OutputDir, baseFileName)
+	master, err := os.ReadFile(masterPath)
+	if err != nil {
+		return classify(v.Context(), err, nil)
+	}
+	if err := os.WriteFile(masterPath, []byte(hlsSubtitleMaster(string(master), baseFileName, subs)), 0644); err != nil {
+		return classify(v.Context(), err, nil)
+	}
+
+	return nil
+}
+
+// addDASHSubtitles adds the subtitles of v to its MPEG-DASH manifest, as text adaptation sets
+// numbered after the video and audio ones. If convert is set, the WebVTT files are made first.
+func (ve *VideoEncoder) addDASHSubtitles(v *Video, baseFileName string, convert bool) error {
+	subs := v.Options.Subtitles
+	if len(subs) == 0 {
+		return nil
+	}
+
+	if convert {
+		if err := ve.convertSubtitles(v, baseFileName, false); err != nil {
+			return err
+		}
+	}
+
+	mpdPath := fmt.Sprintf("%s/%s.mpd", v.OutputDir, baseFileName)
+	mpd, err := os.ReadFile(mpdPath)
+	if err != nil {
+		return classify(v.Context(), err, nil)
+	}
+	manifest, err := dashSubtitleManifest(string(mpd), baseFileName, subs, 2)
+	if err != nil {
+		return fmt.Errorf("%s: %w", mpdPath, err)
+	}
+	if err := os.WriteFile(mpdPath, []byte(manifest), 0644); err != nil {
+		return classify(v.Context(), err, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package streamer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_validateSubtitles(t *testing.T) {
+	if err := validateSubtitles([]Subtitle{{File: "a.srt"}, {File: "b.VTT"}, {File: "c.ass"}}); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+	for _, file := range []string{"a.txt", "", "a"} {
+		if err := validateSubtitles([]Subtitle{{File: file}}); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%q: expected ErrInvalidInput but got %v", file, err)
+		}
+	}
+}
+
+func Test_hlsSubtitleMaster(t *testing.T) {
+	master := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=1405600,RESOLUTION=1280x720,CODECS="avc1.42c01f,mp4a.40.2"
+b-720p.m3u8
+
+#EXT-X-STREAM-INF:BANDWIDTH=580800,RESOLUTION=854x480,CODECS="avc1.42c01e,mp4a.40.2"
+b-480p.m3u8
+
+`
+	subs := []Subtitle{
+		{File: "en.srt", Language: "en", Label: "English", Default: true},
+		{File: "x.vtt"},
+	}
+
+	want := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="b-subs-1.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Subtitles 2",DEFAULT=NO,AUTOSELECT=YES,URI="b-subs-2.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1405600,RESOLUTION=1280x720,CODECS="avc1.42c01f,mp4a.40.2",SUBTITLES="subs"
+b-720p.m3u8
+
+#EXT-X-STREAM-INF:BANDWIDTH=580800,RESOLUTION=854x480,CODECS="avc1.42c01e,mp4a.40.2",SUBTITLES="subs"
+b-480p.m3u8
+
+`
+	if got := hlsSubtitleMaster(master, "b", subs); got != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, got)
+	}
+}
+
+func Test_subtitlePlaylist(t *testing.T) {
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:63\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:62.500,\nb-subs-1.vtt\n#EXT-X-ENDLIST\n"
+	if got := subtitlePlaylist("b-subs-1.vtt", 62500*time.Millisecond); got != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func Test_withTimestampMap(t *testing.T) {
+	vtt := "WEBVTT\r\n\r\n00:00:01.000 --> 00:00:02.000\r\nHello\r\n"
+	want := "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:126000,LOCAL:00:00:00.000\n\r\n00:00:01.000 --> 00:00:02.000\r\nHello\r\n"
+	if got := withTimestampMap(vtt); got != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func Test_dashSubtitleManifest(t *testing.T) {
+	mpd := `<?xml version="1.0" encoding="utf-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011">
+	<Period id="0" start="PT0.0S">
+		<AdaptationSet id="0" contentType="video">
+		</AdaptationSet>
+	</Period>
+</MPD>
+`
+	got, err := dashSubtitleManifest(mpd, "b", []Subtitle{{File: "fr.srt", Language: "fr", Label: "Français & co"}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `		</AdaptationSet>
+		<AdaptationSet id="2" contentType="text" mimeType="text/vtt" lang="fr">
+			<Role schemeIdUri="urn:mpeg:dash:role:2011" value="subtitle"/>
+			<Label>Français &amp; co</Label>
+			<Representation id="subtitle-1" bandwidth="256">
+				<BaseURL>b-subs-1.vtt</BaseURL>
+			</Representation>
+		</AdaptationSet>
+	</Period>
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("expected manifest to contain\n%s\nbut got\n%s", want, got)
+	}
+
+	if _, err := dashSubtitleManifest("<MPD/>", "b", []Subtitle{{File: "fr.srt"}}, 2); err == nil {
+		t.Error("expected an error for a manifest without a period")
+	}
+}
+
+func Test_filterValue(t *testing.T) {
+	if got, want := filterValue(`C:\subs\it's.srt`), `C\\:\\\\subs\\\\it\\\'s.srt`; got != want {
+		t.Errorf("expected %s but got %s", want, got)
+	}
+}
+
+func Test_mp4Args(t *testing.T) {
+	wp := New(make(chan VideoProcessingJob), 1)
+	ops := &VideoOptions{Subtitles: []Subtitle{
+		{File: "./a/en.srt", Language: "eng", Label: "English"},
+		{File: "./a/fr.ass", Language: "fra"},
+	}}
+	v := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "mp4", testNotifyChan, ops)
+
+	cmd := strings.Join(mp4Args(&v, "b"), " ")
+	want := "-y -i ./a/b.mp4 -i ./a/en.srt -i ./a/fr.ass -map 0:v:0 -map 0:a:0? -map 1:s:0 -map 2:s:0 -c:s mov_text " +
+		"-metadata:s:s:0 language=eng -metadata:s:s:0 title=English -metadata:s:s:1 language=fra -metadata:s:s:1 title=fra " +
+		"-c:v libx264 -progress - -nostats ./testdata/output/b.mp4"
+	if cmd != want {
+		t.Errorf("expected %q but got %q", want, cmd)
+	}
+
+	// The first subtitle is burned in, and the rest are still tracks.
+	ops.BurnSubtitles = true
+	cmd = strings.Join(mp4Args(&v, "b"), " ")
+	want = "-y -i ./a/b.mp4 -i ./a/fr.ass -vf subtitles=./a/en.srt -map 0:v:0 -map 0:a:0? -map 1:s:0 -c:s mov_text " +
+		"-metadata:s:s:0 language=fra -metadata:s:s:0 title=fra -c:v libx264 -progress - -nostats ./testdata/output/b.mp4"
+	if cmd != want {
+		t.Errorf("expected %q but got %q", want, cmd)
+	}
+
+	// Without subtitles, nothing changes.
+	v.Options = &VideoOptions{}
+	if cmd := strings.Join(mp4Args(&v, "b"), " "); cmd != "-y -i ./a/b.mp4 -c:v libx264 -progress - -nostats ./testdata/output/b.mp4" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+}
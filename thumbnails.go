@@ -0,0 +1,186 @@
+package streamer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ThumbnailOptions says which images to take from a video once it has been encoded. A poster is
+// always taken, and thumbnails too if Count is above zero. The images are written to the output
+// directory, named after the output, e.g. name-poster.jpg and name-thumb-320-001.jpg.
+type ThumbnailOptions struct {
+	PosterAt    time.Duration // When in the video to take the poster from. If zero, the most representative frame of the first few seconds is used.
+	PosterWidth int           // The width of the poster in pixels. If zero, the width of the video.
+	Count       int           // How many thumbnails to take, evenly spaced through the video.
+	Widths      []int         // The widths of the thumbnails in pixels. Each thumbnail is taken at every width. If empty, 320.
+	Format      string        // The format of the images: "jpg" or "webp". If empty, "jpg".
+}
+
+// representativeFrames is how many frames at the start of the video the thumbnail filter of
+// ffmpeg looks at to pick a poster when no time is given.
+const representativeFrames = 300
+
+// format returns the format of the images, with the default filled in.
+func (o *ThumbnailOptions) format() string {
+	if o.Format == "" {
+		return "jpg"
+	}
+	return o.Format
+}
+
+// widths returns the widths of the thumbnails, with the default filled in.
+func (o *ThumbnailOptions) widths() []int {
+	if len(o.Widths) == 0 {
+		return []int{320}
+	}
+	return o.Widths
+}
+
+// validate returns an error matching ErrInvalidInput if o can't be used.
+func (o *ThumbnailOptions) validate() error {
+	switch {
+	case o.format() != "jpg" && o.format() != "webp":
+		return fmt.Errorf("%w: invalid thumbnail format %q", ErrInvalidInput, o.Format)
+	case o.PosterAt < 0:
+		return fmt.Errorf("%w: invalid poster time %s", ErrInvalidInput, o.PosterAt)
+	case o.PosterWidth < 0:
+		return fmt.Errorf("%w: invalid poster width %d", ErrInvalidInput, o.PosterWidth)
+	case o.Count < 0:
+		return fmt.Errorf("%w: invalid thumbnail count %d", ErrInvalidInput, o.Count)
+	}
+	for _, w := range o.widths() {
+		if w <= 0 {
+			return fmt.Errorf("%w: invalid thumbnail width %d", ErrInvalidInput, w)
+		}
+	}
+	return nil
+}
+
+// posterName returns the file name of the poster for the output with the given base file name.
+func (o *ThumbnailOptions) posterName(baseFileName string) string {
+	return fmt.Sprintf("%s-poster.%s", baseFileName, o.format())
+}
+
+// thumbnailName returns the file name of the thumbnail with the given number, counting from
+// one, at the given width.
+func (o *ThumbnailOptions) thumbnailName(baseFileName string, n, width int) string {
+	return fmt.Sprintf("%s-thumb-%d-%03d.%s", baseFileName, width, n, o.format())
+}
+
+// thumbnailNames returns the file names of all the thumbnails for the output with the given
+// base file name, in order of time and then width.
+func (o *ThumbnailOptions) thumbnailNames(baseFileName string) []string {
+	var names []string
+	for n := 1; n <= o.Count; n++ {
+		for _, w := range o.widths() {
+			names = append(names, o.thumbnailName(baseFileName, n, w))
+		}
+	}
+	return names
+}
+
+// thumbnailTimes returns count times spread evenly through a video of the given duration,
+// leaving out the very start and end, which are often black.
+func thumbnailTimes(duration time.Duration, count int) []time.Duration {
+	times := make([]time.Duration, count)
+	for i := range times {
+		times[i] = duration * time.Duration(i+1) / time.Duration(count+1)
+	}
+	return times
+}
+
+// seconds formats d as a number of seconds, as ffmpeg expects for -ss.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// imageArgs returns the ffmpeg arguments which set the codec and quality of an image in the
+// given format.
+func imageArgs(format string) []string {
+	if format == "webp" {
+		return []string{"-c:v", "libwebp", "-quality", "80"}
+	}
+	return []string{"-q:v", "2"}
+}
+
+// posterArgs returns the arguments for ffmpeg to take the poster of v. Without a time to take it
+// from, the thumbnail filter picks the frame most like the rest of the first few seconds.
+func posterArgs(v *Video, baseFileName string, o *ThumbnailOptions) []string {
+	args := []string{"-y"}
+	if o.PosterAt > 0 {
+		args = append(args, "-ss", seconds(o.PosterAt)) // Seeking before the input is fast.
+	}
+	args = append(args, "-i", v.InputFile, "-map", "0:v:0")
+
+	var filters []string
+	if o.PosterAt == 0 {
+		filters = append(filters, fmt.Sprintf("thumbnail=n=%d", representativeFrames))
+	}
+	if o.PosterWidth > 0 {
+		filters = append(filters, fmt.Sprintf("scale=%d:-2", o.PosterWidth))
+	}
+	if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
+	}
+
+	args = append(args, "-frames:v", "1")
+	args = append(args, imageArgs(o.format())...)
+
+	return append(args, fmt.Sprintf("%s/%s", v.OutputDir, o.posterName(baseFileName)))
+}
+
+// thumbnailArgs returns the arguments for ffmpeg to take the thumbnail with the given number,
+// counting from one, from v at the given time, writing one image for each width.
+func thumbnailArgs(v *Video, baseFileName string, o *ThumbnailOptions, n int, at time.Duration) []string {
+	args := []string{"-y", "-ss", seconds(at), "-i", v.InputFile}
+	for _, w := range o.widths() {
+		args = append(args,
+			"-map", "0:v:0",
+			"-vf", fmt.Sprintf("scale=%d:-2", w),
+			"-frames:v", "1",
+		)
+		args = append(args, imageArgs(o.format())...)
+		args = append(args, fmt.Sprintf("%s/%s", v.OutputDir, o.thumbnailName(baseFileName, n, w)))
+	}
+	return args
+}
+
+// EncodeThumbnails takes a Video object and the base file name of its output, and takes the
+// poster and thumbnails asked for in v.Options.Thumbnails.
+// The ffmpeg process is killed if the context of v is cancelled.
+func (ve *VideoEncoder) EncodeThumbnails(v *Video, baseFileName string) error {
+	o := v.Options.Thumbnails
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	// We only need the duration to place the images, and to check that they are in the video.
+	var duration time.Duration
+	if o.PosterAt > 0 || o.Count > 0 {
+		info, err := Probe(v.Context(), v.InputFile)
+		if err != nil {
+			return err
+		}
+		duration = info.Duration
+		if duration <= 0 {
+			return fmt.Errorf("%w: the duration of the input is unknown", ErrInvalidInput)
+		}
+		if o.PosterAt >= duration {
+			return fmt.Errorf("%w: poster time %s is after the end of the video", ErrInvalidInput, o.PosterAt)
+		}
+	}
+
+	if err := ve.runFFmpeg(v, posterArgs(v, baseFileName, o)...); err != nil {
+		return err
+	}
+
+	for i, at := range thumbnailTimes(duration, o.Count) {
+		if err := ve.runFFmpeg(v, thumbnailArgs(v, baseFileName, o, i+1, at)...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package streamer
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThumbnailOptions_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     ThumbnailOptions
+		wantErr bool
+	}{
+		{name: "defaults", ops: ThumbnailOptions{}},
+		{name: "webp", ops: ThumbnailOptions{Format: "webp", Count: 5, Widths: []int{160, 320}}},
+		{name: "bad format", ops: ThumbnailOptions{Format: "png"}, wantErr: true},
+		{name: "negative count", ops: ThumbnailOptions{Count: -1}, wantErr: true},
+		{name: "bad width", ops: ThumbnailOptions{Count: 1, Widths: []int{320, 0}}, wantErr: true},
+		{name: "negative poster time", ops: ThumbnailOptions{PosterAt: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ops.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %t but got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("expected %v to be ErrInvalidInput", err)
+			}
+		})
+	}
+}
+
+func Test_thumbnailTimes(t *testing.T) {
+	got := thumbnailTimes(100*time.Second, 4)
+	want := []time.Duration{20 * time.Second, 40 * time.Second, 60 * time.Second, 80 * time.Second}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+}
+
+func Test_posterArgs(t *testing.T) {
+	v := Video{InputFile: "./a/b.mp4", OutputDir: "./testdata/output"}
+
+	cmd := strings.Join(posterArgs(&v, "b", &ThumbnailOptions{}), " ")
+	want := "-y -i ./a/b.mp4 -map 0:v:0 -vf thumbnail=n=300 -frames:v 1 -q:v 2 ./testdata/output/b-poster.jpg"
+	if cmd != want {
+		t.Errorf("expected %q but got %q", want, cmd)
+	}
+
+	cmd = strings.Join(posterArgs(&v, "b", &ThumbnailOptions{PosterAt: 1500 * time.Millisecond, PosterWidth: 1280, Format: "webp"}), " ")
+	want = "-y -ss 1.500 -i ./a/b.mp4 -map 0:v:0 -vf scale=1280:-2 -frames:v 1 -c:v libwebp -quality 80 ./testdata/output/b-poster.webp"
+	if cmd != want {
+		t.Errorf("expected %q but got %q", want, cmd)
+	}
+}
+
+func Test_thumbnailArgs(t *testing.T) {
+	v := Video{InputFile: "./a/b.mp4", OutputDir: "./testdata/output"}
+	ops := &ThumbnailOptions{Count: 3, Widths: []int{160, 320}}
+
+	cmd := strings.Join(thumbnailArgs(&v, "b", ops, 2, 10*time.Second), " ")
+	for _, want := range []string{
+		"-y -ss 10.000 -i ./a/b.mp4 ",
+		"-map 0:v:0 -vf scale=160:-2 -frames:v 1 -q:v 2 ./testdata/output/b-thumb-160-002.jpg",
+		"-map 0:v:0 -vf scale=320:-2 -frames:v 1 -q:v 2 ./testdata/output/b-thumb-320-002.jpg",
+	} {
+		if !strings.Contains(cmd, want) {
+			t.Errorf("expected command to contain %q but got %q", want, cmd)
+		}
+	}
+
+	names := ops.thumbnailNames("b")
+	if len(names) != 6 || names[0] != "b-thumb-160-001.jpg" || names[5] != "b-thumb-320-003.jpg" {
+		t.Errorf("unexpected thumbnail names %v", names)
+	}
+}
+
+func TestVideo_thumbnails(t *testing.T) {
+	wp := New(make(chan VideoProcessingJob), 1, testProcessor)
+	ops := &VideoOptions{Thumbnails: &ThumbnailOptions{Count: 2}}
+	v := wp.NewVideo(1, "./testdata/i.mp4", "./testdata/output", "mp4", testNotifyChan, ops)
+
+	v.encode()
+
+	result := <-testNotifyChan
+	if !result.Successful {
+		t.Fatalf("expected success but got %+v", result)
+	}
+	if result.Poster != "i-poster.jpg" {
+		t.Errorf("expected poster i-poster.jpg but got %q", result.Poster)
+	}
+	if !slices.Equal(result.Thumbnails, []string{"i-thumb-320-001.jpg", "i-thumb-320-002.jpg"}) {
+		t.Errorf("unexpected thumbnails %v", result.Thumbnails)
+	}
+
+	// Without thumbnails, none are reported.
+	v = wp.NewVideo(2, "./testdata/i.mp4", "./testdata/output", "mp4", testNotifyChan, nil)
+	v.encode()
+	if result := <-testNotifyChan; result.Poster != "" || result.Thumbnails != nil {
+		t.Errorf("expected no images but got %+v", result)
+	}
+}
@@ -0,0 +1,72 @@
+package streamer
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the name of the tracer used for every span.
+const tracerName = "github.com/tsawler/streamer"
+
+// The spans of a traced job. The job span covers everything from the dispatcher taking the
+// job to it finishing. Under it, a wait span covers each time the job waits for a worker,
+// including any backoff before a retry, and an encode span covers each attempt at the job.
+// Under each encode span is a span for every run of ffmpeg.
+const (
+	spanJob    = "streamer.job"
+	spanWait   = "streamer.wait"
+	spanEncode = "streamer.encode"
+	spanFFmpeg = "ffmpeg"
+)
+
+// Attributes of the spans.
+const (
+	attrVideoID      = attribute.Key("streamer.video.id")
+	attrEncodingType = attribute.Key("streamer.encoding_type")
+	attrPriority     = attribute.Key("streamer.priority")
+	attrState        = attribute.Key("streamer.state")
+	attrWorker       = attribute.Key("streamer.worker")
+	attrAttempt      = attribute.Key("streamer.attempt")
+	attrRenditions   = attribute.Key("streamer.renditions")
+	attrExitCode     = attribute.Key("process.exit.code")
+)
+
+// tracer returns the tracer of vd.TracerProvider, or one which does nothing if it is nil.
+func (vd *VideoDispatcher) tracer() trace.Tracer {
+	if vd.TracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return vd.TracerProvider.Tracer(tracerName)
+}
+
+// startSpan starts a span with the given name as a child of the span in the context of v, using
+// the same tracer provider; if there is no span there, the new span does nothing.
+func (v *Video) startSpan(name string, attrs ...attribute.KeyValue) trace.Span {
+	parent := trace.SpanFromContext(v.Context())
+	_, span := parent.TracerProvider().Tracer(tracerName).Start(v.Context(), name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// endSpan ends span, recording err as its status if it is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endJobSpan ends the spans of job, if it has them, recording the state the job ended in.
+func endJobSpan(job VideoProcessingJob, state JobState, err error) {
+	if job.wait != nil {
+		job.wait.End()
+	}
+	if job.ctx == nil {
+		return
+	}
+	span := trace.SpanFromContext(job.ctx)
+	span.SetAttributes(attrState.String(string(state)))
+	endSpan(span, err)
+}
@@ -0,0 +1,77 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestVideoDispatcher_TracerProvider(t *testing.T) {
+	engine := testEncoderFunc{fn: func(v *Video) error {
+		if v.ID == 2 {
+			return errors.New("some error")
+		}
+		v.renditionNames = []string{"720p", "480p"}
+		v.startSpan(spanFFmpeg).End()
+		return nil
+	}}
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	wp := New(nil, 1, Processor{Engine: &engine})
+	wp.TracerProvider = provider
+	wp.Run()
+	defer wp.Shutdown(context.Background())
+
+	// The job span is a child of any span in the context of the video.
+	parentCtx, parent := provider.Tracer("test").Start(context.Background(), "upload")
+	notifyChan := make(chan ProcessingMessage, 10)
+	v1 := wp.NewVideo(1, "./a/b.mp4", "./testdata/output", "hls", notifyChan, nil).WithContext(parentCtx)
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: v1})
+	<-notifyChan
+	v2 := wp.NewVideo(2, "./a/b.mp4", "./testdata/output", "mp4", notifyChan, nil)
+	_ = wp.Submit(context.Background(), VideoProcessingJob{Video: v2})
+	<-notifyChan
+	parent.End()
+
+	spans := exporter.GetSpans().Snapshots()
+	byName := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = append(byName[s.Name()], s)
+	}
+
+	// Each video has a job, wait, and encode span, and the first runs ffmpeg once. The job span
+	// of the second video may not have ended by the time its message is sent.
+	if len(byName[spanJob]) < 1 || len(byName[spanWait]) != 2 || len(byName[spanEncode]) != 2 || len(byName[spanFFmpeg]) != 1 {
+		t.Fatalf("unexpected spans: %v", byName)
+	}
+
+	job := byName[spanJob][0]
+	if job.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the job span to be a child of the span of the video")
+	}
+	attrs := make(map[string]string)
+	for _, kv := range job.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs[string(attrVideoID)] != "1" || attrs[string(attrEncodingType)] != "hls" || attrs[string(attrState)] != string(JobSucceeded) || attrs[string(attrRenditions)] != `["720p","480p"]` {
+		t.Errorf("unexpected job span attributes %v", attrs)
+	}
+
+	for _, name := range []string{spanWait, spanEncode} {
+		if s := byName[name][0]; s.Parent().SpanID() != job.SpanContext().SpanID() {
+			t.Errorf("expected the %s span to be a child of the job span", name)
+		}
+	}
+	if byName[spanFFmpeg][0].Parent().SpanID() != byName[spanEncode][0].SpanContext().SpanID() {
+		t.Error("expected the ffmpeg span to be a child of the encode span")
+	}
+
+	if s := byName[spanEncode][1]; s.Status().Code != codes.Error {
+		t.Errorf("expected the failed encode to have an error status but got %v", s.Status())
+	}
+}